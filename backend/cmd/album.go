@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+type AlbumItem struct {
+	ID          ItemID `json:"id"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Credits     string `json:"credits"`
+	// Srcset lists the resized variants of the image created on upload
+	Srcset string `json:"srcset,omitempty"`
+	// Photo holds the camera details read from the image's EXIF or XMP data
+	Photo *PhotoMetadata `json:"photo,omitempty"`
+	// PublishOn pins the item to a date (YYYY-MM-DD) instead of its queue position
+	PublishOn string `json:"publish_on,omitempty"`
+}
+
+// publishDateLayout is the format of AlbumItem.PublishOn
+const publishDateLayout = "2006-01-02"
+
+// ItemID identifies an album item. IDs are assigned by the server, older
+// album files also contain numeric IDs which are read as their decimal string.
+type ItemID string
+
+// itemIDPattern is what the IDs of new items may look like, they become part
+// of remote paths. UUIDs and the numeric IDs of older albums match it.
+var itemIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func (id *ItemID) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*id = ""
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = ItemID(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("item id must be a string or a number: %s", data)
+	}
+	*id = ItemID(n.String())
+	return nil
+}
+
+// newItemID returns a random UUIDv4 item ID
+func newItemID() ItemID {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return ItemID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// assignItemIDs gives every item without an ID a new one
+func assignItemIDs(items []AlbumItem) {
+	for i := range items {
+		if items[i].ID == "" {
+			items[i].ID = newItemID()
+		}
+	}
+}
+
+func indexOfItem(items []AlbumItem, id ItemID) int {
+	for i, item := range items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextItemIndex picks the item to publish on day: an item pinned to that day,
+// otherwise the first item that isn't pinned to a later day. Items whose pinned
+// day has passed are treated like unpinned ones so they aren't stuck forever.
+func nextItemIndex(items []AlbumItem, day string) int {
+	for i, item := range items {
+		if item.PublishOn == day {
+			return i
+		}
+	}
+
+	for i, item := range items {
+		if item.PublishOn == "" || item.PublishOn < day {
+			return i
+		}
+	}
+	return -1
+}
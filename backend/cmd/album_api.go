@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var (
+	errAlbumItemNotFound = errors.New("album item not found")
+	errStaleAlbum        = errors.New("album was changed since it was loaded, reload and try again")
+	errAlbumETagRequired = errors.New("If-Match is required, load the album and send its ETag back")
+)
+
+// albumItemPatch holds the fields a PATCH request may change, fields left
+// out of the request are nil and keep their value
+type albumItemPatch struct {
+	URL         *string        `json:"url"`
+	Description *string        `json:"description"`
+	Credits     *string        `json:"credits"`
+	Srcset      *string        `json:"srcset"`
+	Photo       *PhotoMetadata `json:"photo"`
+	// PublishOn set to "" removes the pinned date
+	PublishOn *string `json:"publish_on"`
+}
+
+func (p albumItemPatch) apply(item *AlbumItem) {
+	if p.URL != nil {
+		item.URL = *p.URL
+	}
+	if p.Description != nil {
+		item.Description = *p.Description
+	}
+	if p.Credits != nil {
+		item.Credits = *p.Credits
+	}
+	if p.Srcset != nil {
+		item.Srcset = *p.Srcset
+	}
+	if p.Photo != nil {
+		item.Photo = p.Photo
+	}
+	if p.PublishOn != nil {
+		item.PublishOn = *p.PublishOn
+	}
+}
+
+// albumReorderRequest moves one item to a new position in the queue
+type albumReorderRequest struct {
+	ID       ItemID `json:"id"`
+	Position int    `json:"position"`
+}
+
+// albumETag derives a strong ETag from the serialized album queue
+func albumETag(items []AlbumItem) string {
+	if items == nil {
+		items = []AlbumItem{}
+	}
+	data, _ := json.Marshal(items)
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`"%x"`, sum[:16])
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func setCORSHeaders(w http.ResponseWriter, methods string) {
+	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// updateQueue loads the album queue, lets fn change it and saves the result,
+// all while holding the data lock
+func updateQueue(store Store, fn func(items []AlbumItem) ([]AlbumItem, error)) error {
+	return withDataLock(func() error {
+		items, err := store.Queue()
+		if err != nil {
+			return err
+		}
+
+		items, err = fn(items)
+		if err != nil {
+			return err
+		}
+		return store.SaveQueue(items)
+	})
+}
+
+// albumItemsHandler serves /api/album/items, POST appends a new item to the queue
+func albumItemsHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, "GET, POST, OPTIONS")
+
+		switch r.Method {
+		case "OPTIONS":
+			w.WriteHeader(http.StatusOK)
+
+		case "GET":
+			items, err := store.Queue()
+			if err != nil {
+				http.Error(w, "Failed to read album", http.StatusInternalServerError)
+				log.Printf("Failed to read album: %v", err)
+				return
+			}
+			if items == nil {
+				items = []AlbumItem{}
+			}
+			writeJSON(w, http.StatusOK, items)
+
+		case "POST":
+			var item AlbumItem
+			if err := decodeJSONBody(r, &item); err != nil {
+				writeRequestError(w, err)
+				return
+			}
+
+			// IDs are always assigned by the server
+			item.ID = newItemID()
+
+			if errs := validateAlbumItem(item); len(errs) > 0 {
+				writeRequestError(w, errs)
+				return
+			}
+
+			err := updateQueue(store, func(items []AlbumItem) ([]AlbumItem, error) {
+				items = append(items, item)
+				if errs := validatePublishDates(items); len(errs) > 0 {
+					return nil, errs
+				}
+				return items, nil
+			})
+			var verr validationError
+			if errors.As(err, &verr) {
+				writeRequestError(w, verr)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to save album item", http.StatusInternalServerError)
+				log.Printf("Failed to save album item: %v", err)
+				return
+			}
+
+			w.Header().Set("Location", fmt.Sprintf("/api/album/items/%s", item.ID))
+			writeJSON(w, http.StatusCreated, item)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// albumItemHandler serves /api/album/items/{id}
+func albumItemHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, "GET, PATCH, DELETE, OPTIONS")
+		id := ItemID(r.PathValue("id"))
+
+		switch r.Method {
+		case "OPTIONS":
+			w.WriteHeader(http.StatusOK)
+
+		case "GET":
+			items, err := store.Queue()
+			if err != nil {
+				http.Error(w, "Failed to read album", http.StatusInternalServerError)
+				log.Printf("Failed to read album: %v", err)
+				return
+			}
+
+			index := indexOfItem(items, id)
+			if index < 0 {
+				http.Error(w, errAlbumItemNotFound.Error(), http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, items[index])
+
+		case "PATCH":
+			var patch albumItemPatch
+			if err := decodeJSONBody(r, &patch); err != nil {
+				writeRequestError(w, err)
+				return
+			}
+
+			var updated AlbumItem
+			err := updateQueue(store, func(items []AlbumItem) ([]AlbumItem, error) {
+				index := indexOfItem(items, id)
+				if index < 0 {
+					return nil, errAlbumItemNotFound
+				}
+				patch.apply(&items[index])
+				if errs := validateAlbumItem(items[index]); len(errs) > 0 {
+					return nil, errs
+				}
+				if errs := validatePublishDates(items); len(errs) > 0 {
+					return nil, errs
+				}
+				updated = items[index]
+				return items, nil
+			})
+			var verr validationError
+			if errors.Is(err, errAlbumItemNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if errors.As(err, &verr) {
+				writeRequestError(w, verr)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to save album item", http.StatusInternalServerError)
+				log.Printf("Failed to save album item: %v", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, updated)
+
+		case "DELETE":
+			err := updateQueue(store, func(items []AlbumItem) ([]AlbumItem, error) {
+				index := indexOfItem(items, id)
+				if index < 0 {
+					return nil, errAlbumItemNotFound
+				}
+				return append(items[:index], items[index+1:]...), nil
+			})
+			if errors.Is(err, errAlbumItemNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to delete album item", http.StatusInternalServerError)
+				log.Printf("Failed to delete album item: %v", err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// albumReorderHandler serves /api/album/reorder, moving a single item so
+// concurrent edits to other items are kept
+func albumReorderHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, "POST, OPTIONS")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req albumReorderRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			writeRequestError(w, err)
+			return
+		}
+
+		var reordered []AlbumItem
+		err := updateQueue(store, func(items []AlbumItem) ([]AlbumItem, error) {
+			index := indexOfItem(items, req.ID)
+			if index < 0 {
+				return nil, errAlbumItemNotFound
+			}
+
+			// Clamp the target so out of range positions move to either end
+			position := req.Position
+			if position < 0 {
+				position = 0
+			} else if position > len(items)-1 {
+				position = len(items) - 1
+			}
+
+			item := items[index]
+			items = append(items[:index], items[index+1:]...)
+			items = append(items[:position], append([]AlbumItem{item}, items[position:]...)...)
+			reordered = items
+			return items, nil
+		})
+		if errors.Is(err, errAlbumItemNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to reorder album", http.StatusInternalServerError)
+			log.Printf("Failed to reorder album: %v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, reordered)
+	}
+}
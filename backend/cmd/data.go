@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// dataDir returns the directory holding the store, the journal and uploads
+func dataDir() string {
+	dir := viper.GetString("data.dir")
+	if dir == "" {
+		return "data"
+	}
+	return dir
+}
+
+// dataPath joins the given elements onto the data directory
+func dataPath(elem ...string) string {
+	return filepath.Join(append([]string{dataDir()}, elem...)...)
+}
+
+// writeFileAtomic replaces path with data through a synced temp file and a
+// rename, so readers and crashes never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	// Clean up the temp file on failure, after the rename this is a no-op
+	defer os.Remove(tmpPath)
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself survives a crash
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Policies for a write that succeeded at some destinations but not all
+const (
+	partialFailureAbort = "abort"
+	partialFailureWarn  = "warn"
+)
+
+func init() {
+	viper.SetDefault("publish.on_partial_failure", partialFailureAbort)
+}
+
+// destination is a Publisher together with the name it is configured under
+type destination struct {
+	Name      string
+	Publisher Publisher
+}
+
+// destinationResult reports how a write went at one destination
+type destinationResult struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// configList reads a list setting, which may be given as a comma or space
+// separated string, e.g. in an environment variable
+func configList(key string) []string {
+	var values []string
+	for _, value := range viper.GetStringSlice(key) {
+		values = append(values, splitList(value)...)
+	}
+	return values
+}
+
+// splitList splits a comma or space separated list
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// destinationNames returns the names in publish.destinations, or just
+// "default" when no list is configured
+func destinationNames() []string {
+	names := configList("publish.destinations")
+	if len(names) == 0 {
+		return []string{"default"}
+	}
+	return names
+}
+
+// destinationPrefix returns the config prefix of the named destination.
+// "default" is the single destination configured under destination.*,
+// every other name is configured under destinations.<name>.*
+func destinationPrefix(name string) string {
+	if name == "default" {
+		return defaultDestination
+	}
+	return "destinations." + name
+}
+
+// openDestinations returns a Publisher for every configured destination
+func openDestinations() ([]destination, error) {
+	var destinations []destination
+	for _, name := range destinationNames() {
+		publisher, err := newPublisher(destinationPrefix(name))
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %v", name, err)
+		}
+		destinations = append(destinations, destination{Name: name, Publisher: publisher})
+	}
+	return destinations, nil
+}
+
+// putAll writes remotePath to every destination, calling open for a fresh
+// reader each time. Whether a failure at some of them fails the write
+// depends on publish.on_partial_failure, a failure at all of them always does.
+func putAll(remotePath string, open func() (io.ReadCloser, error)) ([]destinationResult, error) {
+	destinations, err := openDestinations()
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the content once to check every copy against
+	want, err := digestContent(open)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]destinationResult, 0, len(destinations))
+	var failed []string
+	for _, dest := range destinations {
+		result := destinationResult{Name: dest.Name}
+		if err := putOne(dest.Publisher, remotePath, open, want); err != nil {
+			log.Printf("Error writing %s to destination %s: %v", remotePath, dest.Name, err)
+			result.Error = err.Error()
+			failed = append(failed, dest.Name)
+		}
+		results = append(results, result)
+	}
+
+	if len(failed) == 0 {
+		return results, nil
+	}
+	if len(failed) < len(destinations) && viper.GetString("publish.on_partial_failure") == partialFailureWarn {
+		log.Printf("Warning: %s was not written to %s", remotePath, strings.Join(failed, ", "))
+		return results, nil
+	}
+	return results, fmt.Errorf("failed to write %s to %s", remotePath, strings.Join(failed, ", "))
+}
+
+// deleteAll removes remotePath from every destination, a destination that
+// fails doesn't keep it from the others
+func deleteAll(remotePath string) error {
+	destinations, err := openDestinations()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, dest := range destinations {
+		if err := dest.Publisher.Delete(remotePath); err != nil {
+			log.Printf("Error deleting %s from destination %s: %v", remotePath, dest.Name, err)
+			failed = append(failed, dest.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete %s from %s", remotePath, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// anyDestinationSucceeded reports whether a write went through at one or more
+// destinations
+func anyDestinationSucceeded(results []destinationResult) bool {
+	for _, result := range results {
+		if result.Error == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func digestContent(open func() (io.ReadCloser, error)) (fileDigest, error) {
+	r, err := open()
+	if err != nil {
+		return fileDigest{}, err
+	}
+	defer r.Close()
+
+	return digestReader(r)
+}
+
+// putOne writes remotePath and reads it back to check that it arrived intact,
+// a corrupted copy is written again
+func putOne(publisher Publisher, remotePath string, open func() (io.ReadCloser, error), want fileDigest) error {
+	for attempt := 1; ; attempt++ {
+		if err := putOnce(publisher, remotePath, open); err != nil {
+			return err
+		}
+
+		err := verifyRemote(publisher, remotePath, want)
+		if err == nil || !errors.Is(err, errChecksumMismatch) || attempt == putAttempts {
+			return err
+		}
+		log.Printf("Warning: %v, uploading again (attempt %d of %d)", err, attempt+1, putAttempts)
+	}
+}
+
+func putOnce(publisher Publisher, remotePath string, open func() (io.ReadCloser, error)) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return publisher.Put(remotePath, r)
+}
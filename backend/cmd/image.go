@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+
+	"github.com/spf13/viper"
+
+	// Register the decoders of the accepted formats with image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// allowedImageTypes maps the content types /api/upload accepts to the
+// extension the file is stored with
+var allowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var (
+	errUnsupportedImage = errors.New("unsupported file type")
+	errInvalidImage     = errors.New("invalid image")
+	errImageTooLarge    = errors.New("image too large")
+)
+
+// multipartOverhead is allowed on top of upload.max_size for the form's
+// boundaries and headers
+const multipartOverhead = 64 << 10
+
+func init() {
+	viper.SetDefault("upload.max_size", "10MB")
+	// Decoding needs memory for every pixel, a small file can claim a huge
+	// canvas so the dimensions are limited separately from the file size
+	viper.SetDefault("upload.max_width", 16384)
+	viper.SetDefault("upload.max_height", 16384)
+	viper.SetDefault("upload.max_pixels", 50_000_000)
+}
+
+// maxUploadSize returns the largest file /api/upload accepts in bytes,
+// upload.max_size takes a number of bytes or a size like "25MB"
+func maxUploadSize() int64 {
+	return int64(viper.GetSizeInBytes("upload.max_size"))
+}
+
+// checkImageDimensions enforces the upload.max_* pixel limits, a limit of 0
+// is disabled
+func checkImageDimensions(width, height int) error {
+	if limit := viper.GetInt("upload.max_width"); limit > 0 && width > limit {
+		return fmt.Errorf("%w: %d pixels wide, the limit is %d", errImageTooLarge, width, limit)
+	}
+	if limit := viper.GetInt("upload.max_height"); limit > 0 && height > limit {
+		return fmt.Errorf("%w: %d pixels high, the limit is %d", errImageTooLarge, height, limit)
+	}
+	if limit := viper.GetInt64("upload.max_pixels"); limit > 0 && int64(width)*int64(height) > limit {
+		return fmt.Errorf("%w: %dx%d is %d pixels, the limit is %d", errImageTooLarge, width, height, int64(width)*int64(height), limit)
+	}
+	return nil
+}
+
+// imageInfo describes an uploaded image as detected from its content
+type imageInfo struct {
+	ContentType string `json:"content_type"`
+	Ext         string `json:"-"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	// Orientation is the EXIF orientation, from 5 on the pixels are stored
+	// turned by 90° and Width and Height are swapped to the displayed size
+	Orientation int `json:"-"`
+}
+
+// oriented returns info for an image stored with the given EXIF orientation
+func (info imageInfo) oriented(orientation int) imageInfo {
+	info.Orientation = orientation
+	if orientation >= 5 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+	return info
+}
+
+// sniffImage detects the type of r from its magic bytes and decodes the
+// image header to check that it is a well-formed image of an allowed type
+// within the pixel limits. The client's filename and Content-Type are not
+// trusted. r is rewound before returning.
+func sniffImage(r io.ReadSeeker) (imageInfo, error) {
+	// 1. Detect the type from the first bytes
+	header := make([]byte, 512)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return imageInfo{}, fmt.Errorf("%w: the file is empty", errInvalidImage)
+		}
+		return imageInfo{}, fmt.Errorf("error reading file: %v", err)
+	}
+	contentType := http.DetectContentType(header[:n])
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return imageInfo{}, fmt.Errorf("%w %s, expected a JPEG, PNG, GIF or WebP image", errUnsupportedImage, contentType)
+	}
+
+	// 2. Decode the header to make sure the rest of the file matches
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return imageInfo{}, fmt.Errorf("error reading file: %v", err)
+	}
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return imageInfo{}, fmt.Errorf("%w: %v", errInvalidImage, err)
+	}
+	if "image/"+format != contentType {
+		return imageInfo{}, fmt.Errorf("%w: %s content decodes as %s", errInvalidImage, contentType, format)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return imageInfo{}, fmt.Errorf("%w: %dx%d pixels", errInvalidImage, config.Width, config.Height)
+	}
+	if err := checkImageDimensions(config.Width, config.Height); err != nil {
+		return imageInfo{}, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return imageInfo{}, fmt.Errorf("error reading file: %v", err)
+	}
+	return imageInfo{
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       config.Width,
+		Height:      config.Height,
+	}, nil
+}
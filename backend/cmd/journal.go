@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Steps recorded in the publish journal, in the order the publish pipeline runs them
+const (
+	journalStepStarted  = "started"
+	journalStepUploaded = "uploaded"
+	journalStepPurged   = "purged"
+	journalStepArchived = "archived"
+	journalStepDequeued = "dequeued"
+	journalStepRecorded = "recorded"
+)
+
+// publishJournal records the progress of a publish so that a run interrupted
+// between the upload of today.json and the album/archive updates can be repaired.
+// Once the item is uploaded the publish is completed on recovery, before
+// that it is rolled back.
+type publishJournal struct {
+	Item      AlbumItem  `json:"item"`
+	Previous  *AlbumItem `json:"previous,omitempty"`
+	Steps     []string   `json:"steps"`
+	StartedAt time.Time  `json:"started_at"`
+	// Paths are the remote paths the publish changed, they are purged from
+	// the CDN once the upload is done
+	Paths []string `json:"paths,omitempty"`
+}
+
+func journalPath() string {
+	return dataPath("publish.journal.json")
+}
+
+// beginPublishJournal starts a journal for publishing item to paths, previous
+// is the item today.json pointed to before
+func beginPublishJournal(item AlbumItem, previous *AlbumItem, paths []string) (*publishJournal, error) {
+	if _, err := os.Stat(journalPath()); err == nil {
+		return nil, fmt.Errorf("an unfinished publish is recorded in %s", journalPath())
+	}
+
+	j := &publishJournal{
+		Item:      item,
+		Previous:  previous,
+		StartedAt: time.Now(),
+		Paths:     paths,
+	}
+	if err := j.record(journalStepStarted); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// changedPaths returns the paths to purge, journals written before paths were
+// recorded only changed today.json
+func (j *publishJournal) changedPaths() []string {
+	if len(j.Paths) == 0 {
+		return []string{"today.json"}
+	}
+	return j.Paths
+}
+
+func (j *publishJournal) has(step string) bool {
+	for _, s := range j.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *publishJournal) record(step string) error {
+	j.Steps = append(j.Steps, step)
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("error serializing publish journal: %v", err)
+	}
+	if err := writeFileAtomic(journalPath(), data, 0o644); err != nil {
+		return fmt.Errorf("error writing publish journal: %v", err)
+	}
+	return nil
+}
+
+func (j *publishJournal) commit() error {
+	if err := os.Remove(journalPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing publish journal: %v", err)
+	}
+	return nil
+}
+
+// rollback restores today.json to the previous item, or removes it if
+// nothing was published before, removes the permalink of the item that
+// wasn't published and drops the journal
+func (j *publishJournal) rollback() error {
+	if permalink, err := itemPermalinkPath(j.Item.ID); err != nil {
+		log.Printf("Warning: Not removing the permalink of item %s: %v", j.Item.ID, err)
+	} else if err := deleteAll(permalink); err != nil {
+		log.Printf("Warning: Failed to remove the permalink of item %s: %v", j.Item.ID, err)
+	}
+
+	if j.Previous != nil {
+		// A destination the new item never reached may fail again, the
+		// restore only has to succeed somewhere
+		results, err := uploadToday(*j.Previous)
+		if err != nil && !anyDestinationSucceeded(results) {
+			return fmt.Errorf("error restoring today.json to item %s: %v", j.Previous.ID, err)
+		} else if err != nil {
+			log.Printf("Warning: today.json was only partly restored: %v", err)
+		}
+	} else if err := deleteAll("today.json"); err != nil {
+		// The item stays queued, a feed showing it would announce it twice
+		return fmt.Errorf("error removing today.json of the first publish: %v", err)
+	}
+	if err := purgeOrQueue(j.changedPaths()...); err != nil {
+		log.Printf("Warning: Failed to invalidate CDN cache: %v\n", err)
+	}
+	return j.commit()
+}
+
+// complete runs the remaining local steps of a publish whose upload succeeded
+func (j *publishJournal) complete(store Store) error {
+	if !j.has(journalStepPurged) {
+		if err := purgeOrQueue(j.changedPaths()...); err != nil {
+			log.Printf("Warning: Failed to invalidate CDN cache: %v\n", err)
+		} else if err := j.record(journalStepPurged); err != nil {
+			return err
+		}
+	}
+
+	if !j.has(journalStepArchived) {
+		if err := archiveItem(store, j.Item); err != nil {
+			return err
+		}
+		if err := j.record(journalStepArchived); err != nil {
+			return err
+		}
+	}
+
+	if !j.has(journalStepDequeued) {
+		if err := dequeueItem(store, j.Item); err != nil {
+			return err
+		}
+		if err := j.record(journalStepDequeued); err != nil {
+			return err
+		}
+	}
+
+	if !j.has(journalStepRecorded) {
+		if err := store.AddHistory(j.publishRecord()); err != nil {
+			return err
+		}
+		if err := j.record(journalStepRecorded); err != nil {
+			return err
+		}
+	}
+
+	return j.commit()
+}
+
+// publishRecord returns the history entry for the journaled publish
+func (j *publishJournal) publishRecord() PublishRecord {
+	return PublishRecord{
+		ItemID:      string(j.Item.ID),
+		URL:         j.Item.URL,
+		PublishedAt: j.StartedAt,
+	}
+}
+
+// recoverPublishJournal repairs a publish that was interrupted, it is a no-op
+// when no journal exists
+func recoverPublishJournal(store Store) error {
+	data, err := os.ReadFile(journalPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading publish journal: %v", err)
+	}
+
+	var j publishJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return fmt.Errorf("error parsing publish journal: %v", err)
+	}
+
+	id := j.Item.ID
+	if j.has(journalStepUploaded) {
+		log.Printf("Completing interrupted publish of item %s started at %s", id, j.StartedAt.Format(time.RFC3339))
+		if err := j.complete(store); err != nil {
+			return fmt.Errorf("error completing interrupted publish of item %s: %v", id, err)
+		}
+		return nil
+	}
+
+	log.Printf("Rolling back interrupted publish of item %s started at %s", id, j.StartedAt.Format(time.RFC3339))
+	if err := j.rollback(); err != nil {
+		return fmt.Errorf("error rolling back interrupted publish of item %s: %v", id, err)
+	}
+	return nil
+}
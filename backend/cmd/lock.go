@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// dataLockTimeout is how long a command waits for another one holding the data lock
+const dataLockTimeout = 30 * time.Second
+
+// lockData takes the advisory lock on the data directory that the server and
+// the CLI commands share, the returned function releases it
+func lockData() (func(), error) {
+	if err := os.MkdirAll(dataDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %v", err)
+	}
+
+	lockPath := dataPath(".lock")
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %v", err)
+	}
+
+	deadline := time.Now().Add(dataLockTimeout)
+	for {
+		locked, err := tryLockFile(lockFile)
+		if err != nil {
+			lockFile.Close()
+			return nil, fmt.Errorf("error locking %s: %v", lockPath, err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			lockFile.Close()
+			return nil, fmt.Errorf("timed out waiting for %s, is another dimagram command running?", lockPath)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return func() {
+		unlockFile(lockFile)
+		lockFile.Close()
+	}, nil
+}
+
+// withDataLock runs fn while holding the data lock
+func withDataLock(fn func() error) error {
+	unlock, err := lockData()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fn()
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package cmd
+
+import "os"
+
+// Advisory locks are only implemented with flock, other platforms run unlocked
+
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,476 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// PhotoMetadata holds the camera settings and authorship an image carries in
+// its EXIF or XMP data, fields the image doesn't have are left empty
+type PhotoMetadata struct {
+	Camera       string `json:"camera,omitempty"`
+	Lens         string `json:"lens,omitempty"`
+	FocalLength  string `json:"focal_length,omitempty"`
+	Aperture     string `json:"aperture,omitempty"`
+	ExposureTime string `json:"exposure_time,omitempty"`
+	ISO          int    `json:"iso,omitempty"`
+	// TakenAt is the capture time like 2006-01-02T15:04:05, with an offset
+	// only if the image records one
+	TakenAt   string `json:"taken_at,omitempty"`
+	Artist    string `json:"artist,omitempty"`
+	Copyright string `json:"copyright,omitempty"`
+}
+
+// exifDateLayout is how EXIF writes dates
+const exifDateLayout = "2006:01:02 15:04:05"
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// readPhotoMetadata extracts the EXIF and XMP metadata of the image at path.
+// EXIF values win, XMP fills in what EXIF doesn't have. Metadata is optional,
+// so nil is returned if the image has none or it can't be parsed.
+func readPhotoMetadata(path string, info imageInfo) *PhotoMetadata {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var m PhotoMetadata
+	if raw := exifData(data, info.ContentType); raw != nil && checkEXIF(raw) == nil {
+		// Decode may return usable tags together with an error about others
+		if x, _ := exif.Decode(bytes.NewReader(raw)); x != nil {
+			m.fillFromEXIF(x)
+		}
+	}
+	if start := bytes.Index(data, []byte("<x:xmpmeta")); start >= 0 {
+		if end := bytes.Index(data[start:], []byte("</x:xmpmeta>")); end >= 0 {
+			m.fillFromXMP(parseXMP(data[start : start+end+len("</x:xmpmeta>")]))
+		}
+	}
+
+	if m == (PhotoMetadata{}) {
+		return nil
+	}
+	return &m
+}
+
+// exifHeader precedes the EXIF block in a JPEG APP1 segment, some writers
+// add it to the PNG and WebP chunks as well
+var exifHeader = []byte("Exif\x00\x00")
+
+// exifData returns the EXIF block of an image, the TIFF structure starting
+// with its byte order. JPEG keeps it in an APP1 segment, PNG and WebP in a
+// chunk of their own.
+func exifData(data []byte, contentType string) []byte {
+	switch contentType {
+	case "image/jpeg":
+		// Segments of a marker and a big endian length that includes itself,
+		// up to the start of the compressed data
+		for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+			marker := data[pos+1]
+			if marker == 0xFF {
+				// Fill byte before a marker
+				pos++
+				continue
+			}
+			length := int(binary.BigEndian.Uint16(data[pos+2:]))
+			if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+				return nil
+			}
+			if segment := data[pos+4 : pos+2+length]; marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+				return segment[len(exifHeader):]
+			}
+			pos += 2 + length
+		}
+	case "image/png":
+		// 8 byte signature, then chunks of length, type, data and CRC
+		for pos := 8; pos+8 <= len(data); {
+			length := int(binary.BigEndian.Uint32(data[pos:]))
+			kind := string(data[pos+4 : pos+8])
+			if length < 0 || pos+8+length > len(data) || kind == "IDAT" {
+				return nil
+			}
+			if kind == "eXIf" {
+				return bytes.TrimPrefix(data[pos+8:pos+8+length], exifHeader)
+			}
+			pos += 12 + length
+		}
+	case "image/webp":
+		// "RIFF", size, "WEBP", then chunks of type, little endian length and
+		// data padded to an even length
+		for pos := 12; pos+8 <= len(data); {
+			kind := string(data[pos : pos+4])
+			length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+			if length < 0 || pos+8+length > len(data) {
+				return nil
+			}
+			if kind == "EXIF" {
+				return bytes.TrimPrefix(data[pos+8:pos+8+length], exifHeader)
+			}
+			pos += 8 + length + length%2
+		}
+	}
+	return nil
+}
+
+// tiffHeader returns the byte order of a TIFF structure and the offset of
+// its first IFD
+func tiffHeader(raw []byte) (binary.ByteOrder, int, bool) {
+	if len(raw) < 8 {
+		return nil, 0, false
+	}
+	var order binary.ByteOrder
+	switch string(raw[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	return order, int(order.Uint32(raw[4:])), true
+}
+
+// maxEXIFSize is the largest EXIF block that is parsed, a JPEG APP1 segment
+// can't hold more
+const maxEXIFSize = 64 << 10
+
+// tiffTypeSizes are the sizes in bytes of the TIFF value types by their id
+var tiffTypeSizes = map[uint16]uint64{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// The tags that point to the Exif, GPS and Interoperability IFDs
+const (
+	exifIFDTag    = 0x8769
+	gpsIFDTag     = 0x8825
+	interopIFDTag = 0xA005
+)
+
+// checkEXIF walks the IFDs of an EXIF block like exif.Decode does and
+// rejects blocks it can't handle safely. goexif allocates for the value count
+// a tag claims before checking it against the data, so a single tag can
+// exhaust the memory, and IFDs pointing at each other make it loop forever.
+func checkEXIF(raw []byte) error {
+	if len(raw) > maxEXIFSize {
+		return fmt.Errorf("EXIF block of %d bytes is larger than %d", len(raw), maxEXIFSize)
+	}
+	order, first, ok := tiffHeader(raw)
+	if !ok {
+		return errors.New("EXIF block has no TIFF header")
+	}
+
+	// The values of all tags together can't be larger than the block
+	// without overlapping, which real images don't do
+	var valuesSize uint64
+	var subIFDs []int
+	visited := make(map[int]bool)
+	checkIFD := func(ifd int) (int, error) {
+		visited[ifd] = true
+		if ifd+2 > len(raw) {
+			return 0, fmt.Errorf("IFD at %d is outside of the EXIF block", ifd)
+		}
+		// A count and entries of 12 bytes: tag, type, count and the value
+		// or its offset, then the offset of the next IFD
+		entries := int(order.Uint16(raw[ifd:]))
+		end := ifd + 2 + 12*entries
+		if end+4 > len(raw) {
+			return 0, fmt.Errorf("IFD at %d with %d entries is outside of the EXIF block", ifd, entries)
+		}
+
+		for entry := ifd + 2; entry < end; entry += 12 {
+			tag, kind, count := order.Uint16(raw[entry:]), order.Uint16(raw[entry+2:]), uint64(order.Uint32(raw[entry+4:]))
+			size := tiffTypeSizes[kind] * count
+			if size > 4 && uint64(order.Uint32(raw[entry+8:]))+size > uint64(len(raw)) {
+				return 0, fmt.Errorf("tag %#04x with %d values is outside of the EXIF block", tag, count)
+			}
+			if valuesSize += size; valuesSize > uint64(len(raw)) {
+				return 0, fmt.Errorf("tag %#04x with %d values doesn't fit into the EXIF block", tag, count)
+			}
+
+			// goexif follows the first value of a pointer of any integer type
+			if (tag == exifIFDTag || tag == gpsIFDTag || tag == interopIFDTag) && count > 0 {
+				value := entry + 8
+				if size > 4 {
+					value = int(order.Uint32(raw[entry+8:]))
+				}
+				switch kind {
+				case 1, 6:
+					subIFDs = append(subIFDs, int(raw[value]))
+				case 3, 8:
+					subIFDs = append(subIFDs, int(order.Uint16(raw[value:])))
+				case 4, 9:
+					subIFDs = append(subIFDs, int(order.Uint32(raw[value:])))
+				}
+			}
+		}
+		return int(order.Uint32(raw[end:])), nil
+	}
+
+	// 1. The main chain of IFDs, each links to the next one
+	for ifd := first; ifd != 0; {
+		if visited[ifd] {
+			return fmt.Errorf("IFD at %d is linked to twice", ifd)
+		}
+		next, err := checkIFD(ifd)
+		if err != nil {
+			return err
+		}
+		ifd = next
+	}
+
+	// 2. The Exif, GPS and Interoperability IFDs, whose links are ignored
+	for len(subIFDs) > 0 {
+		ifd := subIFDs[0]
+		subIFDs = subIFDs[1:]
+		if visited[ifd] {
+			continue
+		}
+		if _, err := checkIFD(ifd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readOrientation returns the EXIF orientation of the image at path, from 1
+// for upright to 8. Images without one are upright.
+func readOrientation(path string, info imageInfo) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 1
+	}
+	return exifOrientation(exifData(data, info.ContentType))
+}
+
+// exifOrientation finds the orientation tag in the first IFD of an EXIF
+// block, where it always is
+func exifOrientation(raw []byte) int {
+	order, ifd, ok := tiffHeader(raw)
+	if !ok || ifd+2 > len(raw) {
+		return 1
+	}
+
+	// An IFD is a count and entries of 12 bytes: tag, type, count and the
+	// value if it fits in 4 bytes
+	for entry := ifd + 2; entry < ifd+2+12*int(order.Uint16(raw[ifd:])) && entry+12 <= len(raw); entry += 12 {
+		const orientationTag, shortType = 0x0112, 3
+		if order.Uint16(raw[entry:]) != orientationTag || order.Uint16(raw[entry+2:]) != shortType {
+			continue
+		}
+		if value := int(order.Uint16(raw[entry+8:])); value >= 1 && value <= 8 {
+			return value
+		}
+	}
+	return 1
+}
+
+func (m *PhotoMetadata) fillFromEXIF(x *exif.Exif) {
+	str := func(name exif.FieldName) string {
+		tag, err := x.Get(name)
+		if err != nil {
+			return ""
+		}
+		s, err := tag.StringVal()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+	}
+	rat := func(name exif.FieldName) (int64, int64, bool) {
+		tag, err := x.Get(name)
+		if err != nil {
+			return 0, 0, false
+		}
+		num, den, err := tag.Rat2(0)
+		return num, den, err == nil && den != 0
+	}
+
+	m.Camera = cameraName(str(exif.Make), str(exif.Model))
+	m.Lens = str(exif.LensModel)
+	if num, den, ok := rat(exif.FocalLength); ok {
+		m.FocalLength = formatFocalLength(num, den)
+	}
+	if num, den, ok := rat(exif.FNumber); ok {
+		m.Aperture = formatAperture(num, den)
+	}
+	if num, den, ok := rat(exif.ExposureTime); ok {
+		m.ExposureTime = formatExposureTime(num, den)
+	}
+	if tag, err := x.Get(exif.ISOSpeedRatings); err == nil {
+		m.ISO, _ = tag.Int(0)
+	}
+	m.TakenAt = formatEXIFDate(str(exif.DateTimeOriginal))
+	if m.TakenAt == "" {
+		m.TakenAt = formatEXIFDate(str(exif.DateTime))
+	}
+	m.Artist = str(exif.Artist)
+	m.Copyright = str(exif.Copyright)
+}
+
+// fillFromXMP sets the fields that are still empty from the properties of an
+// XMP packet
+func (m *PhotoMetadata) fillFromXMP(props map[string]string) {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+
+	fill(&m.Camera, cameraName(props["Make"], props["Model"]))
+	fill(&m.Lens, props["LensModel"])
+	fill(&m.Lens, props["Lens"])
+	if num, den, ok := parseRational(props["FocalLength"]); ok {
+		fill(&m.FocalLength, formatFocalLength(num, den))
+	}
+	if num, den, ok := parseRational(props["FNumber"]); ok {
+		fill(&m.Aperture, formatAperture(num, den))
+	}
+	if num, den, ok := parseRational(props["ExposureTime"]); ok {
+		fill(&m.ExposureTime, formatExposureTime(num, den))
+	}
+	if m.ISO == 0 {
+		m.ISO, _ = strconv.Atoi(props["ISOSpeedRatings"])
+	}
+	fill(&m.TakenAt, props["DateTimeOriginal"])
+	fill(&m.TakenAt, props["DateCreated"])
+	fill(&m.TakenAt, props["CreateDate"])
+	fill(&m.Artist, props["creator"])
+	fill(&m.Copyright, props["rights"])
+}
+
+// parseXMP returns the properties of an XMP packet by their local name. They
+// can be attributes of rdf:Description or elements, whose value may be
+// wrapped in an rdf:Seq, rdf:Bag or rdf:Alt. The entries of a list of
+// creators are joined, of other lists only the first one is kept.
+func parseXMP(packet []byte) map[string]string {
+	props := make(map[string]string)
+	set := func(name, value string) {
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+		case props[name] == "":
+			props[name] = value
+		case name == "creator":
+			props[name] += ", " + value
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	var stack []xml.Name
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return props
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			for _, attr := range t.Attr {
+				if attr.Name.Space != rdfNamespace && attr.Name.Space != "xmlns" {
+					set(attr.Name.Local, attr.Value)
+				}
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			// The value belongs to the closest element outside of the rdf
+			// containers
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].Space != rdfNamespace {
+					set(stack[i].Local, string(t))
+					break
+				}
+			}
+		}
+	}
+}
+
+// cameraName joins make and model, leaving out the make if the model
+// already starts with the brand like "NIKON CORPORATION" "NIKON D2H"
+func cameraName(maker, model string) string {
+	brand, _, _ := strings.Cut(maker, " ")
+	switch {
+	case model == "":
+		return maker
+	case brand == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(brand)):
+		return model
+	default:
+		return maker + " " + model
+	}
+}
+
+// parseRational reads an XMP rational like 28/10
+func parseRational(s string) (int64, int64, bool) {
+	numStr, denStr, found := strings.Cut(s, "/")
+	if !found {
+		denStr = "1"
+	}
+	num, err := strconv.ParseInt(numStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	den, err := strconv.ParseInt(denStr, 10, 64)
+	if err != nil || den == 0 {
+		return 0, 0, false
+	}
+	return num, den, true
+}
+
+// formatTenths prints a number rounded to one decimal, without a trailing .0
+func formatTenths(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
+
+func formatFocalLength(num, den int64) string {
+	return formatTenths(float64(num)/float64(den)) + "mm"
+}
+
+func formatAperture(num, den int64) string {
+	return "f/" + formatTenths(float64(num)/float64(den))
+}
+
+// formatExposureTime prints short exposures as a fraction like photographers
+// do, e.g. 1/250s, and long ones in seconds
+func formatExposureTime(num, den int64) string {
+	if num <= 0 {
+		return ""
+	}
+	seconds := float64(num) / float64(den)
+	if seconds < 1 {
+		return fmt.Sprintf("1/%ds", int64(math.Round(1/seconds)))
+	}
+	return formatTenths(seconds) + "s"
+}
+
+func formatEXIFDate(s string) string {
+	t, err := time.Parse(exifDateLayout, s)
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
+
+// credits suggests the credits of an item from the artist and copyright, the
+// copyright alone if it already names the artist
+func (m *PhotoMetadata) credits() string {
+	switch {
+	case m == nil:
+		return ""
+	case m.Copyright == "" || m.Artist == "":
+		return m.Artist + m.Copyright
+	case strings.Contains(m.Copyright, m.Artist):
+		return m.Copyright
+	default:
+		return m.Artist + ", " + m.Copyright
+	}
+}
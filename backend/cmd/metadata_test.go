@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// tiffEntry is a tag of an IFD, value holds the value or its offset
+type tiffEntry struct {
+	tag, kind    uint16
+	count, value uint32
+}
+
+// tiffBlock builds a little endian EXIF block of size bytes with IFDs at the
+// given offsets, the first at 8, each linking to the IFD at next[offset]
+func tiffBlock(size int, ifds map[uint32][]tiffEntry, next map[uint32]uint32) []byte {
+	raw := make([]byte, size)
+	copy(raw, "II*\x00")
+	binary.LittleEndian.PutUint32(raw[4:], 8)
+	for offset, entries := range ifds {
+		pos := int(offset)
+		binary.LittleEndian.PutUint16(raw[pos:], uint16(len(entries)))
+		pos += 2
+		for _, e := range entries {
+			binary.LittleEndian.PutUint16(raw[pos:], e.tag)
+			binary.LittleEndian.PutUint16(raw[pos+2:], e.kind)
+			binary.LittleEndian.PutUint32(raw[pos+4:], e.count)
+			binary.LittleEndian.PutUint32(raw[pos+8:], e.value)
+			pos += 12
+		}
+		binary.LittleEndian.PutUint32(raw[pos:], next[offset])
+	}
+	return raw
+}
+
+// hugeCountEXIF has one LONG tag claiming 0x40000001 values, 4 times that
+// overflows to 4 bytes in goexif which then allocates 8GB for the values
+func hugeCountEXIF() []byte {
+	return tiffBlock(30, map[uint32][]tiffEntry{8: {{tag: 0x0100, kind: 4, count: 0x40000001}}}, nil)
+}
+
+func jpegWithEXIF(raw []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), raw...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}
+	data = append(data, segment...)
+	return append(data, 0xFF, 0xD9)
+}
+
+func pngWithEXIF(raw []byte) []byte {
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(raw)))
+	data = append(data, "eXIf"...)
+	data = append(data, raw...)
+	return append(data, 0, 0, 0, 0)
+}
+
+func TestReadPhotoMetadataHugeCount(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+	}{
+		{"jpeg", "image/jpeg", jpegWithEXIF(hugeCountEXIF())},
+		{"png", "image/png", pngWithEXIF(hugeCountEXIF())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if m := readPhotoMetadata(path, imageInfo{ContentType: tt.contentType}); m != nil {
+				t.Errorf("readPhotoMetadata() = %+v, want nil", m)
+			}
+		})
+	}
+}
+
+func TestCheckEXIF(t *testing.T) {
+	artist := tiffEntry{tag: 0x013B, kind: 2, count: 6, value: 26}
+	// Each fits after the IFD, together they are larger than the block
+	overlap := tiffEntry{tag: 0x013B, kind: 2, count: 30, value: 74}
+	tests := []struct {
+		name    string
+		raw     []byte
+		wantErr bool
+	}{
+		{"valid", tiffBlock(40, map[uint32][]tiffEntry{8: {artist}}, nil), false},
+		{"orientation", tiffBlock(30, map[uint32][]tiffEntry{8: {{tag: 0x0112, kind: 3, count: 1, value: 6}}}, nil), false},
+		{"huge count", hugeCountEXIF(), true},
+		{"value outside", tiffBlock(30, map[uint32][]tiffEntry{8: {{tag: 0x013B, kind: 2, count: 100, value: 26}}}, nil), true},
+		{"overlapping values", tiffBlock(104, map[uint32][]tiffEntry{8: {overlap, overlap, overlap, overlap, overlap}}, nil), true},
+		{"ifd loop", tiffBlock(40, map[uint32][]tiffEntry{8: nil, 20: nil}, map[uint32]uint32{8: 20, 20: 8}), true},
+		{"ifd outside", tiffBlock(30, map[uint32][]tiffEntry{8: nil}, map[uint32]uint32{8: 1000}), true},
+		{"sub ifd outside", tiffBlock(30, map[uint32][]tiffEntry{8: {{tag: exifIFDTag, kind: 4, count: 1, value: 1000}}}, nil), true},
+		{"no header", []byte("not an EXIF block"), true},
+		{"too large", append(tiffBlock(30, map[uint32][]tiffEntry{8: nil}, nil), make([]byte, maxEXIFSize)...), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkEXIF(tt.raw); (err != nil) != tt.wantErr {
+				t.Errorf("checkEXIF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	raw := tiffBlock(30, map[uint32][]tiffEntry{8: {{tag: 0x0112, kind: 3, count: 1, value: 6}}}, nil)
+	if got := exifOrientation(raw); got != 6 {
+		t.Errorf("exifOrientation() = %d, want 6", got)
+	}
+	if got := exifOrientation(exifData(jpegWithEXIF(raw), "image/jpeg")); got != 6 {
+		t.Errorf("exifOrientation() of a JPEG = %d, want 6", got)
+	}
+	if got := exifOrientation(hugeCountEXIF()); got != 1 {
+		t.Errorf("exifOrientation() without the tag = %d, want 1", got)
+	}
+}
+
+// FuzzEXIF checks that no EXIF block gets goexif to crash or run out of
+// memory once checkEXIF accepted it
+func FuzzEXIF(f *testing.F) {
+	f.Add(hugeCountEXIF())
+	f.Add(tiffBlock(40, map[uint32][]tiffEntry{8: {{tag: 0x013B, kind: 2, count: 6, value: 26}}}, nil))
+	f.Add(tiffBlock(40, map[uint32][]tiffEntry{8: {{tag: exifIFDTag, kind: 4, count: 1, value: 26}}, 26: nil}, nil))
+	f.Add(tiffBlock(40, map[uint32][]tiffEntry{8: nil, 20: nil}, map[uint32]uint32{8: 20, 20: 8}))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		exifOrientation(raw)
+		if checkEXIF(raw) == nil {
+			exif.Decode(bytes.NewReader(raw))
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFrom string
+	migrateTo   string
+)
+
+var migrateStoreCmd = &cobra.Command{
+	Use:   "migrate-store",
+	Short: "Copy all data from one store backend to another",
+	Long: `Copy the album queue, the archive, the publish history and the upload index from one store backend to another, for example from the JSON files to SQLite.
+
+The destination must be empty. Set store.driver (DIMAGRAM_STORE_DRIVER) to the new backend afterwards.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := withDataLock(migrateStore); err != nil {
+			fmt.Printf("Error migrating store: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// GetMigrateStoreCmd returns the migrate-store command
+func GetMigrateStoreCmd() *cobra.Command {
+	return migrateStoreCmd
+}
+
+func init() {
+	migrateStoreCmd.Flags().StringVar(&migrateFrom, "from", "json", "Store to copy from (json or sqlite)")
+	migrateStoreCmd.Flags().StringVar(&migrateTo, "to", "sqlite", "Store to copy to (json or sqlite)")
+}
+
+func migrateStore() error {
+	if migrateFrom == migrateTo {
+		return fmt.Errorf("source and destination are both %s", migrateFrom)
+	}
+
+	src, err := openStoreDriver(migrateFrom)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := openStoreDriver(migrateTo)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	// 1. Read everything from the source
+	queue, err := src.Queue()
+	if err != nil {
+		return err
+	}
+	archive, err := src.Archive()
+	if err != nil {
+		return err
+	}
+	history, err := src.History()
+	if err != nil {
+		return err
+	}
+	uploads, err := src.Uploads()
+	if err != nil {
+		return err
+	}
+
+	// 2. Refuse to overwrite a destination that is already in use
+	if err := ensureEmptyStore(dst); err != nil {
+		return fmt.Errorf("%s store: %v", migrateTo, err)
+	}
+
+	// 3. Copy to the destination in one step, a failure leaves it empty so
+	// the migration can be run again
+	err = dst.Import(storeContents{Queue: queue, Archive: archive, History: history, Uploads: uploads})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated %d queued items, %d archived items, %d publish records and %d uploads from %s to %s\n",
+		len(queue), len(archive), len(history), len(uploads), migrateFrom, migrateTo)
+	return nil
+}
+
+func ensureEmptyStore(store Store) error {
+	queue, err := store.Queue()
+	if err != nil {
+		return err
+	}
+	archive, err := store.Archive()
+	if err != nil {
+		return err
+	}
+	history, err := store.History()
+	if err != nil {
+		return err
+	}
+	uploads, err := store.Uploads()
+	if err != nil {
+		return err
+	}
+
+	if len(queue)+len(archive)+len(history)+len(uploads) > 0 {
+		return fmt.Errorf("already contains data")
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the publish command
+const (
+	exitPublishFailed    = 1
+	exitNothingToPublish = 2
+	exitItemNotFound     = 3
+	exitDayTaken         = 4
+)
+
+var (
+	errNothingToPublish = errors.New("no items in the album")
+	errItemNotFound     = errors.New("item not found in the album")
+	errDayTaken         = errors.New("another item was already published today")
+)
+
+var (
+	publishDryRun bool
+	publishItemID string
+	publishForce  bool
+)
+
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Publish the next image from the album",
+	Long: `Upload the next image from the album as the "today" file, invalidate the CDN cache, and move the item from album to archive.
+
+Only one item is published per calendar day, running it again the same day
+reports the item that was published and changes nothing unless --force is given.
+
+Exit codes:
+  0  the item was published (or would be, with --dry-run), or one was already published today
+  1  publishing failed
+  2  the album has no items to publish
+  3  the item given with --item is not in the album
+  4  the item given with --item was not published because another one was already published today`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openStore()
+		if err != nil {
+			fmt.Printf("Error opening store: %v\n", err)
+			os.Exit(exitPublishFailed)
+		}
+		defer store.Close()
+
+		result, err := publishProcess(store, publishOptions{
+			DryRun: publishDryRun,
+			ItemID: publishItemID,
+			Force:  publishForce,
+		})
+		if err != nil {
+			fmt.Printf("Error publishing: %v\n", err)
+			switch {
+			case errors.Is(err, errNothingToPublish):
+				os.Exit(exitNothingToPublish)
+			case errors.Is(err, errItemNotFound):
+				os.Exit(exitItemNotFound)
+			case errors.Is(err, errDayTaken):
+				os.Exit(exitDayTaken)
+			default:
+				os.Exit(exitPublishFailed)
+			}
+		}
+
+		printPublishSummary(result)
+	},
+}
+
+// GetPublishCmd returns the publish command
+func GetPublishCmd() *cobra.Command {
+	return publishCmd
+}
+
+func init() {
+	publishCmd.Flags().BoolVar(&publishDryRun, "dry-run", false, "Show what would be published without changing anything")
+	publishCmd.Flags().StringVar(&publishItemID, "item", "", "Publish the item with this ID instead of the first one in the album")
+	publishCmd.Flags().BoolVar(&publishForce, "force", false, "Publish even if an item was already published today")
+}
+
+// publishOptions controls a single run of the publish pipeline
+type publishOptions struct {
+	DryRun bool
+	ItemID string
+	// Force publishes even if an item was already published today
+	Force bool
+}
+
+// publishResult summarizes what a publish run changed
+type publishResult struct {
+	Item     AlbumItem `json:"item"`
+	DryRun   bool      `json:"dry_run"`
+	Uploaded []string  `json:"uploaded"`
+	Purged   []string  `json:"purged"`
+	Archived bool      `json:"archived"`
+	// Destinations reports how the upload went at each destination
+	Destinations []destinationResult `json:"destinations"`
+	// AlreadyPublished is set when nothing was done because Item was
+	// already published today
+	AlreadyPublished bool `json:"already_published"`
+}
+
+// publishDay returns the calendar day a publish at t counts for, in the
+// schedule's timezone
+func publishDay(t time.Time) string {
+	// publishProcess and newScheduler already failed if the timezone is
+	// invalid, so this only ever gets the cached location
+	loc, err := publishLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	return t.In(loc).Format(publishDateLayout)
+}
+
+// publishedItemOn returns the item published on day, or nil if there is none.
+// Items that were unpublished again don't count.
+func publishedItemOn(store Store, day string) (*AlbumItem, error) {
+	history, err := store.History()
+	if err != nil {
+		return nil, err
+	}
+	archiveItems, err := store.Archive()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		if publishDay(history[i].PublishedAt) != day {
+			continue
+		}
+		if index := indexOfItem(archiveItems, ItemID(history[i].ItemID)); index >= 0 {
+			return &archiveItems[index], nil
+		}
+	}
+	return nil, nil
+}
+
+func printPublishSummary(result *publishResult) {
+	if result.AlreadyPublished {
+		fmt.Printf("Item %s was already published today, use --force to publish another one\n", result.Item.ID)
+		return
+	}
+
+	verb := "Published"
+	if result.DryRun {
+		verb = "Dry run, would publish"
+	}
+	fmt.Printf("%s item %s with URL: %s\n", verb, result.Item.ID, result.Item.URL)
+	fmt.Printf("  uploaded: %s\n", summaryList(result.Uploaded))
+	fmt.Printf("  purged:   %s\n", summaryList(result.Purged))
+	for _, dest := range result.Destinations {
+		switch {
+		case result.DryRun:
+			fmt.Printf("  destination %s\n", dest.Name)
+		case dest.Error != "":
+			fmt.Printf("  destination %s: failed: %s\n", dest.Name, dest.Error)
+		default:
+			fmt.Printf("  destination %s: ok\n", dest.Name)
+		}
+	}
+	if result.Archived {
+		fmt.Println("  archived: yes")
+	} else {
+		fmt.Println("  archived: no")
+	}
+}
+
+func summaryList(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, ", ")
+}
+
+func publishProcess(store Store, opts publishOptions) (*publishResult, error) {
+	// 0. Repair a previous publish that was interrupted half-way. Which day
+	// an item is published on depends on the timezone, so check it first.
+	if _, err := publishLocation(); err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		if _, err := os.Stat(journalPath()); err == nil {
+			log.Printf("An interrupted publish is recorded in %s and will be repaired first", journalPath())
+		}
+	} else {
+		unlock, err := lockData()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		if err := recoverPublishJournal(store); err != nil {
+			return nil, err
+		}
+	}
+
+	// 1. Load the album queue
+	albumItems, err := store.Queue()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Only publish once per day, a retried request gets the item published earlier
+	if !opts.Force {
+		existing, err := publishedItemOn(store, publishDay(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			// Asking for a different item than the one published must not
+			// look like it went through
+			if opts.ItemID != "" && existing.ID != ItemID(opts.ItemID) {
+				return nil, fmt.Errorf("%w (%s), item %s was not published, use --force to publish it anyway", errDayTaken, existing.ID, opts.ItemID)
+			}
+			return &publishResult{Item: *existing, DryRun: opts.DryRun, AlreadyPublished: true}, nil
+		}
+	}
+
+	if len(albumItems) == 0 {
+		return nil, errNothingToPublish
+	}
+
+	// 3. Pick the requested item, or else the one pinned to today or the next
+	// unpinned one
+	var index int
+	if opts.ItemID != "" {
+		index = indexOfItem(albumItems, ItemID(opts.ItemID))
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %s", errItemNotFound, opts.ItemID)
+		}
+	} else {
+		index = nextItemIndex(albumItems, publishDay(time.Now()))
+		if index < 0 {
+			return nil, fmt.Errorf("%w, all items are pinned to later dates", errNothingToPublish)
+		}
+	}
+	item := albumItems[index]
+	result := &publishResult{Item: item, DryRun: opts.DryRun}
+
+	if opts.DryRun {
+		// Opening the destinations checks their configuration without writing
+		destinations, err := openDestinations()
+		if err != nil {
+			return nil, err
+		}
+		for _, dest := range destinations {
+			result.Destinations = append(result.Destinations, destinationResult{Name: dest.Name})
+		}
+		result.Uploaded, err = publishedPaths(item)
+		if err != nil {
+			return nil, err
+		}
+		result.Purged = purgedPaths(result.Uploaded)
+		result.Archived = true
+		return result, nil
+	}
+
+	// 4. Start the journal, remembering what today.json pointed to so it can be restored
+	archiveItems, err := store.Archive()
+	if err != nil {
+		return nil, err
+	}
+	var previous *AlbumItem
+	if len(archiveItems) > 0 {
+		previous = &archiveItems[len(archiveItems)-1]
+	}
+
+	paths, err := publishedPaths(item)
+	if err != nil {
+		return nil, err
+	}
+	journal, err := beginPublishJournal(item, previous, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Publishing item: %v with URL: %s\n", item.ID, item.URL)
+
+	// 5. Upload item as today.json and as its permalink to every destination
+	result.Destinations, err = uploadItem(item, journal.Paths...)
+	if err != nil {
+		if rollbackErr := journal.rollback(); rollbackErr != nil {
+			log.Printf("Error rolling back publish: %v", rollbackErr)
+		}
+		return nil, fmt.Errorf("error uploading item: %v", err)
+	}
+	result.Uploaded = journal.Paths
+	if err := journal.record(journalStepUploaded); err != nil {
+		return nil, incompletePublishError(item, err)
+	}
+
+	// 6. Invalidate CDN cache for everything the publish changed
+	if err := purgeOrQueue(result.Uploaded...); err != nil {
+		log.Printf("Warning: Failed to invalidate CDN cache: %v\n", err)
+		// Continue execution even if cache invalidation fails
+	} else {
+		result.Purged = purgedPaths(result.Uploaded)
+		if err := journal.record(journalStepPurged); err != nil {
+			return nil, incompletePublishError(item, err)
+		}
+	}
+
+	// 7. Append the item to the archive
+	if err := archiveItem(store, item); err != nil {
+		return nil, incompletePublishError(item, err)
+	}
+	result.Archived = true
+	if err := journal.record(journalStepArchived); err != nil {
+		return nil, incompletePublishError(item, err)
+	}
+
+	// 8. Delete the item from the album queue
+	if err := dequeueItem(store, item); err != nil {
+		return nil, incompletePublishError(item, err)
+	}
+	if err := journal.record(journalStepDequeued); err != nil {
+		return nil, incompletePublishError(item, err)
+	}
+
+	// 9. Record the publish in the history
+	if err := store.AddHistory(journal.publishRecord()); err != nil {
+		return nil, incompletePublishError(item, err)
+	}
+	if err := journal.record(journalStepRecorded); err != nil {
+		return nil, incompletePublishError(item, err)
+	}
+
+	if err := journal.commit(); err != nil {
+		return nil, err
+	}
+
+	log.Println("Successfully published the image, uploaded today.json, invalidated cache, archived the item, and updated album.")
+	return result, nil
+}
+
+// incompletePublishError reports a failure after today.json was replaced, the
+// journal is left behind so the publish is completed on the next start
+func incompletePublishError(item AlbumItem, err error) error {
+	return fmt.Errorf("publish of item %s is incomplete and will be finished on next start: %v", item.ID, err)
+}
+
+// archiveItem appends item to the archive unless it is already the last entry
+func archiveItem(store Store, item AlbumItem) error {
+	archiveItems, err := store.Archive()
+	if err != nil {
+		return err
+	}
+
+	if len(archiveItems) > 0 && archiveItems[len(archiveItems)-1].ID == item.ID {
+		return nil
+	}
+
+	return store.SaveArchive(append(archiveItems, item))
+}
+
+// dequeueItem removes item from the album queue if it is still queued
+func dequeueItem(store Store, item AlbumItem) error {
+	albumItems, err := store.Queue()
+	if err != nil {
+		return err
+	}
+
+	index := indexOfItem(albumItems, item.ID)
+	if index < 0 {
+		return nil
+	}
+
+	return store.SaveQueue(append(albumItems[:index], albumItems[index+1:]...))
+}
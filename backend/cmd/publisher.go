@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/viper"
+)
+
+// defaultDestination is the config prefix of the publishing destination
+const defaultDestination = "destination"
+
+var errObjectNotFound = errors.New("object not found")
+
+// Publisher stores the feed and uploaded images at a destination the CDN
+// serves from. Paths are relative to the destination root and use slashes.
+type Publisher interface {
+	// Put writes the contents of r to path, replacing any existing object.
+	// Readers of path see either the old or the complete new object, or the
+	// write is checked before it returns where the destination can't do that.
+	Put(path string, r io.Reader) error
+	// Delete removes path, a missing object is not an error
+	Delete(path string) error
+	// Stat describes path, it returns errObjectNotFound if there is none
+	Stat(path string) (ObjectInfo, error)
+	// Open reads path back, it returns errObjectNotFound if there is none
+	Open(path string) (io.ReadCloser, error)
+}
+
+// ObjectInfo describes an object stored by a Publisher
+type ObjectInfo struct {
+	Path string
+	// Size is -1 if the destination doesn't report it
+	Size    int64
+	ModTime time.Time
+	// ETag is the checksum reported by the destination, if it has one
+	ETag string
+	// MD5 is the hex MD5 of the content if the destination reports it
+	MD5 string
+}
+
+func init() {
+	viper.SetDefault(defaultDestination+".type", "sftp")
+}
+
+// destinationSetting reads key of the destination configured under prefix.
+// The default destination falls back to legacyEnv, the variables it was
+// configured with before destinations were pluggable.
+func destinationSetting(prefix, key, legacyEnv string) string {
+	if value := viper.GetString(prefix + "." + key); value != "" {
+		return value
+	}
+	if prefix == defaultDestination && legacyEnv != "" {
+		return os.Getenv(legacyEnv)
+	}
+	return ""
+}
+
+// newPublisher returns the Publisher configured under prefix
+func newPublisher(prefix string) (Publisher, error) {
+	godotenv.Load()
+
+	switch kind := viper.GetString(prefix + ".type"); kind {
+	case "sftp":
+		return newSFTPPublisher(prefix)
+	case "local":
+		return newLocalPublisher(prefix)
+	case "webdav":
+		return newWebDAVPublisher(prefix)
+	case "s3":
+		return newS3Publisher(prefix)
+	default:
+		return nil, fmt.Errorf("unknown %s.type %q, expected sftp, local, webdav or s3", prefix, kind)
+	}
+}
+
+// remoteTempPath returns a hidden name next to remotePath to upload to before
+// the file is moved into place
+func remoteTempPath(remotePath string) string {
+	return path.Join(path.Dir(remotePath), "."+path.Base(remotePath)+".tmp-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+}
+
+// checkRemoteSize verifies that a file written in place has the expected size
+func checkRemoteSize(remotePath string, size, written int64) error {
+	if size != written {
+		return fmt.Errorf("%s is %d bytes at the destination but %d were written", remotePath, size, written)
+	}
+	return nil
+}
+
+// readerSize returns the number of bytes left in r, or -1 if r can't tell
+func readerSize(r io.Reader) int64 {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - current
+}
+
+// nopSeekCloser is like io.NopCloser but keeps the reader seekable, so a
+// publisher can rewind it to retry a write
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// uploadToday writes item as today.json, the file the feed is read from, to
+// every destination
+func uploadToday(item AlbumItem) ([]destinationResult, error) {
+	return uploadItem(item, "today.json")
+}
+
+// itemPermalinkPath is where a published item stays available after
+// today.json has moved on to the next one. Items saved before IDs were
+// validated may have any ID, those that would leave items/ are refused.
+func itemPermalinkPath(id ItemID) (string, error) {
+	if id == "" || strings.ContainsAny(string(id), `/\`) || strings.Contains(string(id), "..") {
+		return "", fmt.Errorf("item ID %q can't be used in a remote path", id)
+	}
+	return "items/" + string(id) + ".json", nil
+}
+
+// publishedPaths returns the remote paths a publish of item writes
+func publishedPaths(item AlbumItem) ([]string, error) {
+	permalink, err := itemPermalinkPath(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"today.json", permalink}, nil
+}
+
+// uploadItem writes item as JSON to each of remotePaths at every destination.
+// The result of a destination carries the first error it had.
+func uploadItem(item AlbumItem, remotePaths ...string) ([]destinationResult, error) {
+	// Create JSON content to upload
+	content, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing item data: %v", err)
+	}
+
+	var results []destinationResult
+	for _, remotePath := range remotePaths {
+		pathResults, err := putAll(remotePath, func() (io.ReadCloser, error) {
+			return nopSeekCloser{bytes.NewReader(content)}, nil
+		})
+		if results == nil {
+			results = pathResults
+		} else {
+			for i := range pathResults {
+				if results[i].Error == "" {
+					results[i].Error = pathResults[i].Error
+				}
+			}
+		}
+		if err != nil {
+			return results, err
+		}
+
+		log.Printf("Successfully uploaded item as '%s'", remotePath)
+	}
+	return results, nil
+}
+
+// uploadContentFile uploads a local file into the content directory of every
+// destination
+func uploadContentFile(localFilePath, remoteFileName string) ([]destinationResult, error) {
+	remoteFilePath := "content/" + remoteFileName
+	results, err := putAll(remoteFilePath, func() (io.ReadCloser, error) {
+		// Open local file
+		localFile, err := os.Open(localFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open local file: %v", err)
+		}
+		return localFile, nil
+	})
+	if err != nil {
+		return results, err
+	}
+
+	log.Printf("Successfully uploaded file to '%s'", remoteFilePath)
+	return results, nil
+}
+
+// contentFileExists reports whether a file uploaded earlier is still in the
+// content directory of every destination with the given size, a negative
+// size only checks that it is there
+func contentFileExists(remoteFileName string, size int64) ([]destinationResult, bool) {
+	destinations, err := openDestinations()
+	if err != nil {
+		return nil, false
+	}
+
+	results := make([]destinationResult, 0, len(destinations))
+	for _, dest := range destinations {
+		info, err := dest.Publisher.Stat("content/" + remoteFileName)
+		if err != nil {
+			if !errors.Is(err, errObjectNotFound) {
+				log.Printf("Warning: Failed to check for %s at destination %s: %v", remoteFileName, dest.Name, err)
+			}
+			return nil, false
+		}
+		if size >= 0 && info.Size >= 0 && info.Size != size {
+			return nil, false
+		}
+		results = append(results, destinationResult{Name: dest.Name})
+	}
+	return results, true
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// localPublisher writes into a directory, for self-hosters whose web server
+// serves the feed from the same machine
+type localPublisher struct {
+	root string
+}
+
+func newLocalPublisher(prefix string) (*localPublisher, error) {
+	root := destinationSetting(prefix, "path", "")
+	if root == "" {
+		return nil, fmt.Errorf("%s.path must be set for a local destination", prefix)
+	}
+	return &localPublisher{root: root}, nil
+}
+
+func (p *localPublisher) path(remotePath string) string {
+	return filepath.Join(p.root, filepath.FromSlash(remotePath))
+}
+
+func (p *localPublisher) Put(remotePath string, r io.Reader) error {
+	target := p.path(remotePath)
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// Write next to the target and rename so the web server never serves a partial file
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := io.Copy(tmpFile, r); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to set file mode: %v", err)
+	}
+	if err := os.Rename(tmpFile.Name(), target); err != nil {
+		return fmt.Errorf("failed to move file into place: %v", err)
+	}
+	return nil
+}
+
+func (p *localPublisher) Delete(remotePath string) error {
+	if err := os.Remove(p.path(remotePath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+	return nil
+}
+
+func (p *localPublisher) Stat(remotePath string) (ObjectInfo, error) {
+	info, err := os.Stat(p.path(remotePath))
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, errObjectNotFound
+	} else if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	return ObjectInfo{
+		Path:    remotePath,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (p *localPublisher) Open(remotePath string) (io.ReadCloser, error) {
+	f, err := os.Open(p.path(remotePath))
+	if os.IsNotExist(err) {
+		return nil, errObjectNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Publisher writes to an S3 compatible bucket (AWS, MinIO, R2, ...)
+type s3Publisher struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3Publisher(prefix string) (*s3Publisher, error) {
+	endpoint := destinationSetting(prefix, "endpoint", "")
+	bucket := destinationSetting(prefix, "bucket", "")
+	if endpoint == "" || bucket == "" {
+		return nil, fmt.Errorf("%s.endpoint and %s.bucket must be set for an s3 destination", prefix, prefix)
+	}
+
+	// Plain http is only used when asked for, e.g. for a local MinIO
+	secure := true
+	if strings.HasPrefix(endpoint, "http://") {
+		secure = false
+	}
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "https://"), "http://")
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(
+			destinationSetting(prefix, "access_key", ""),
+			destinationSetting(prefix, "secret_key", ""),
+			"",
+		),
+		Secure: secure,
+		Region: destinationSetting(prefix, "region", ""),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating S3 client: %v", err)
+	}
+
+	return &s3Publisher{
+		client: client,
+		bucket: bucket,
+		prefix: strings.Trim(destinationSetting(prefix, "prefix", ""), "/"),
+	}, nil
+}
+
+func (p *s3Publisher) key(remotePath string) string {
+	remotePath = strings.TrimLeft(remotePath, "/")
+	if p.prefix == "" {
+		return remotePath
+	}
+	return p.prefix + "/" + remotePath
+}
+
+func (p *s3Publisher) Put(remotePath string, r io.Reader) error {
+	// With Content-MD5 S3 rejects a body that got corrupted on the way,
+	// which also covers encrypted objects whose ETag isn't the MD5
+	opts := minio.PutObjectOptions{
+		ContentType:    mime.TypeByExtension(path.Ext(remotePath)),
+		SendContentMd5: true,
+	}
+
+	// Objects only become visible once the upload is complete, so unlike
+	// files no temp name is needed. An unknown size (-1) streams the reader
+	// as a multipart upload.
+	if _, err := p.client.PutObject(context.Background(), p.bucket, p.key(remotePath), r, readerSize(r), opts); err != nil {
+		return fmt.Errorf("failed to put object: %v", err)
+	}
+	return nil
+}
+
+func (p *s3Publisher) Delete(remotePath string) error {
+	// S3 treats deleting a missing key as success
+	if err := p.client.RemoveObject(context.Background(), p.bucket, p.key(remotePath), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %v", err)
+	}
+	return nil
+}
+
+func (p *s3Publisher) Stat(remotePath string) (ObjectInfo, error) {
+	info, err := p.client.StatObject(context.Background(), p.bucket, p.key(remotePath), minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ObjectInfo{}, errObjectNotFound
+		}
+		return ObjectInfo{}, fmt.Errorf("failed to stat object: %v", err)
+	}
+
+	objectInfo := ObjectInfo{
+		Path:    remotePath,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+		ETag:    info.ETag,
+	}
+	// The ETag of an object uploaded in one part is the MD5 of its content,
+	// multipart ETags end in -<parts>. Objects encrypted with KMS or a
+	// customer key have other ETags, without an MD5 they are read back.
+	encryption := info.Metadata.Get("X-Amz-Server-Side-Encryption")
+	customerKey := info.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm")
+	if len(info.ETag) == md5.Size*2 && !strings.Contains(info.ETag, "-") &&
+		!strings.HasPrefix(encryption, "aws:kms") && customerKey == "" {
+		objectInfo.MD5 = strings.ToLower(info.ETag)
+	}
+	return objectInfo, nil
+}
+
+func (p *s3Publisher) Open(remotePath string) (io.ReadCloser, error) {
+	if _, err := p.Stat(remotePath); err != nil {
+		return nil, err
+	}
+
+	obj, err := p.client.GetObject(context.Background(), p.bucket, p.key(remotePath), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %v", err)
+	}
+	return obj, nil
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpPublisher writes to an SFTP server such as Bunny storage, over
+// connections shared by every publisher for the same server
+type sftpPublisher struct {
+	pool *sftpPool
+}
+
+// sftpAddr returns the host:port of the SFTP destination under prefix
+func sftpAddr(prefix string) (string, error) {
+	host := destinationSetting(prefix, "host", "SFTP_HOST")
+	portStr := destinationSetting(prefix, "port", "SFTP_PORT")
+	if host == "" {
+		return "", fmt.Errorf("required SFTP environment variables not set")
+	}
+
+	// Default port is 22 if not specified
+	port := 22
+	if portStr != "" {
+		var err error
+		port, err = strconv.Atoi(portStr)
+		if err != nil {
+			return "", fmt.Errorf("invalid SFTP port: %v", err)
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func newSFTPPublisher(prefix string) (*sftpPublisher, error) {
+	pool, err := getSFTPPool(prefix, func() (*sftpPool, error) {
+		return newSFTPPool(prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sftpPublisher{pool: pool}, nil
+}
+
+// newSFTPPool reads the settings of the destination under prefix into a new
+// pool. Decrypting the private key is slow, so this only runs when there is
+// no pool for the current settings yet.
+func newSFTPPool(prefix string) (*sftpPool, error) {
+	// Get SFTP credentials from config, falling back to the SFTP_* environment
+	addr, err := sftpAddr(prefix)
+	if err != nil {
+		return nil, err
+	}
+	user := destinationSetting(prefix, "user", "SFTP_USER")
+
+	// Validate required settings
+	if user == "" {
+		return nil, fmt.Errorf("required SFTP environment variables not set")
+	}
+
+	hostKeyCallback, knownHosts, err := sftpHostKeyCallback(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure SSH client
+	authMethods, err := sftpAuthMethods(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pool settings, connections idle for longer than the timeout are closed
+	idleTimeout := defaultSFTPIdleTimeout
+	if value := destinationSetting(prefix, "idle_timeout", ""); value != "" {
+		var err error
+		idleTimeout, err = time.ParseDuration(value)
+		if err != nil || idleTimeout <= 0 {
+			return nil, fmt.Errorf("invalid %s.idle_timeout %q", prefix, value)
+		}
+	}
+	maxIdle := defaultSFTPMaxIdle
+	if value := destinationSetting(prefix, "max_idle", ""); value != "" {
+		var err error
+		maxIdle, err = strconv.Atoi(value)
+		if err != nil || maxIdle < 0 {
+			return nil, fmt.Errorf("invalid %s.max_idle %q", prefix, value)
+		}
+	}
+
+	return &sftpPool{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            authMethods,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         15 * time.Second,
+		},
+		knownHosts:  knownHosts,
+		idleTimeout: idleTimeout,
+		maxIdle:     maxIdle,
+	}, nil
+}
+
+func (p *sftpPublisher) Put(remotePath string, r io.Reader) error {
+	// A reader that can be rewound is written again if the connection breaks
+	seeker, retry := r.(io.Seeker)
+
+	return p.pool.do(retry, func(client *sftp.Client) error {
+		if retry {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to rewind upload: %v", err)
+			}
+		}
+
+		// Ensure the parent directory exists on the remote server
+		if dir := path.Dir(remotePath); dir != "." {
+			client.MkdirAll(dir)
+		}
+
+		// Write to a temp name and rename it into place so a reader never sees
+		// a partial file. The plain SFTP rename refuses to replace a file, so
+		// servers without posix-rename get the file written in place and
+		// checked by size instead.
+		if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+			tmpPath := remoteTempPath(remotePath)
+			if _, err := writeSFTPFile(client, tmpPath, r); err != nil {
+				client.Remove(tmpPath)
+				return err
+			}
+			if err := client.PosixRename(tmpPath, remotePath); err != nil {
+				client.Remove(tmpPath)
+				return fmt.Errorf("failed to move remote file into place: %v", err)
+			}
+			return nil
+		}
+
+		written, err := writeSFTPFile(client, remotePath, r)
+		if err != nil {
+			return err
+		}
+		info, err := client.Stat(remotePath)
+		if err != nil {
+			return fmt.Errorf("failed to stat remote file: %v", err)
+		}
+		return checkRemoteSize(remotePath, info.Size(), written)
+	})
+}
+
+// writeSFTPFile writes r to remotePath and returns the number of bytes written
+func writeSFTPFile(client *sftp.Client, remotePath string, r io.Reader) (int64, error) {
+	remoteFile, err := client.Create(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create remote file: %v", err)
+	}
+
+	written, err := io.Copy(remoteFile, r)
+	if err != nil {
+		remoteFile.Close()
+		return 0, fmt.Errorf("failed to write to remote file: %v", err)
+	}
+	if err := remoteFile.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write to remote file: %v", err)
+	}
+	return written, nil
+}
+
+func (p *sftpPublisher) Delete(remotePath string) error {
+	return p.pool.do(true, func(client *sftp.Client) error {
+		if err := client.Remove(remotePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete remote file: %v", err)
+		}
+		return nil
+	})
+}
+
+func (p *sftpPublisher) Stat(remotePath string) (ObjectInfo, error) {
+	var info ObjectInfo
+	err := p.pool.do(true, func(client *sftp.Client) error {
+		fileInfo, err := client.Stat(remotePath)
+		if os.IsNotExist(err) {
+			return errObjectNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to stat remote file: %v", err)
+		}
+
+		info = ObjectInfo{
+			Path:    remotePath,
+			Size:    fileInfo.Size(),
+			ModTime: fileInfo.ModTime(),
+		}
+		return nil
+	})
+	return info, err
+}
+
+func (p *sftpPublisher) Open(remotePath string) (io.ReadCloser, error) {
+	conn, err := p.pool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := conn.sftp.Open(remotePath)
+	if err != nil {
+		p.pool.put(conn, !conn.alive())
+		if os.IsNotExist(err) {
+			return nil, errObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to open remote file: %v", err)
+	}
+	return &pooledSFTPFile{File: f, pool: p.pool, conn: conn}, nil
+}
+
+// pooledSFTPFile hands its connection back to the pool once it is closed
+type pooledSFTPFile struct {
+	*sftp.File
+	pool *sftpPool
+	conn *sftpConn
+}
+
+func (f *pooledSFTPFile) Close() error {
+	err := f.File.Close()
+	f.pool.put(f.conn, err != nil && !f.conn.alive())
+	return err
+}
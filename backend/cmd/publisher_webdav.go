@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errMoveUnsupported is returned by move when the server has no MOVE method
+var errMoveUnsupported = errors.New("MOVE not supported")
+
+// webdavPublisher writes to a WebDAV server such as Nextcloud or an
+// Apache/nginx share
+type webdavPublisher struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+}
+
+func newWebDAVPublisher(prefix string) (*webdavPublisher, error) {
+	baseURL := destinationSetting(prefix, "url", "")
+	if baseURL == "" {
+		return nil, fmt.Errorf("%s.url must be set for a webdav destination", prefix)
+	}
+
+	return &webdavPublisher{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: destinationSetting(prefix, "username", ""),
+		password: destinationSetting(prefix, "password", ""),
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (p *webdavPublisher) url(remotePath string) string {
+	return p.baseURL + "/" + strings.TrimLeft(remotePath, "/")
+}
+
+func (p *webdavPublisher) do(method, remotePath string, body io.Reader, header map[string]string) (*http.Response, error) {
+	// The client closes a body that is a Closer once it is sent, an upload
+	// has to stay open so Put can rewind it and write it again
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = io.NopCloser(body)
+	}
+	req, err := http.NewRequest(method, p.url(remotePath), reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	// Send a Content-Length when the size is known, not every server accepts
+	// chunked uploads
+	if size := readerSize(body); size > 0 {
+		req.ContentLength = size
+	} else if size == 0 {
+		req.Body = http.NoBody
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending HTTP request: %v", err)
+	}
+	return resp, nil
+}
+
+// mkcol creates the parent collections of remotePath one level at a time
+func (p *webdavPublisher) mkcol(remotePath string) error {
+	parts := strings.Split(strings.Trim(remotePath, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		resp, err := p.do("MKCOL", strings.Join(parts[:i], "/")+"/", nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		// 405 means the collection already exists
+		if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("MKCOL failed with status %d", resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+func (p *webdavPublisher) Put(remotePath string, r io.Reader) error {
+	if err := p.mkcol(remotePath); err != nil {
+		return err
+	}
+
+	// Upload to a temp name and MOVE it over the target so a reader never
+	// sees a partial file
+	tmpPath := remoteTempPath(remotePath)
+	if err := p.put(tmpPath, r); err != nil {
+		p.Delete(tmpPath)
+		return err
+	}
+	err := p.move(tmpPath, remotePath)
+	if err == nil {
+		return nil
+	}
+	p.Delete(tmpPath)
+
+	// Servers without MOVE get the file written in place and checked by size
+	seeker, ok := r.(io.Seeker)
+	if !errors.Is(err, errMoveUnsupported) || !ok {
+		return err
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind upload: %v", err)
+	}
+	size := readerSize(r)
+	if err := p.put(remotePath, r); err != nil {
+		return err
+	}
+	info, err := p.Stat(remotePath)
+	if err != nil {
+		return err
+	}
+	if size < 0 || info.Size < 0 {
+		return nil
+	}
+	return checkRemoteSize(remotePath, info.Size, size)
+}
+
+func (p *webdavPublisher) put(remotePath string, r io.Reader) error {
+	resp, err := p.do("PUT", remotePath, r, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("PUT failed (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// move renames from to to, replacing an existing file
+func (p *webdavPublisher) move(from, to string) error {
+	resp, err := p.do("MOVE", from, nil, map[string]string{
+		"Destination": p.url(to),
+		"Overwrite":   "T",
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		return errMoveUnsupported
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("MOVE failed (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (p *webdavPublisher) Delete(remotePath string) error {
+	resp, err := p.do("DELETE", remotePath, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("DELETE failed (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (p *webdavPublisher) Stat(remotePath string) (ObjectInfo, error) {
+	resp, err := p.do("HEAD", remotePath, nil, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ObjectInfo{}, errObjectNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return ObjectInfo{}, fmt.Errorf("HEAD failed with status %d", resp.StatusCode)
+	}
+
+	info := ObjectInfo{
+		Path: remotePath,
+		// -1 when the server doesn't send a Content-Length
+		Size: resp.ContentLength,
+		ETag: strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (p *webdavPublisher) Open(remotePath string) (io.ReadCloser, error) {
+	resp, err := p.do("GET", remotePath, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errObjectNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET failed with status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Retry schedule of failed purges, the delay doubles after every attempt
+const (
+	purgeRetryBaseDelay = 30 * time.Second
+	purgeRetryMaxDelay  = time.Hour
+	purgeMaxAttempts    = 10
+	// purgeRetryPoll is how often the server looks for purges that are due
+	purgeRetryPoll = 15 * time.Second
+	// purgeFailedKept is how many given up purges stay visible in the queue
+	purgeFailedKept = 20
+)
+
+// States of a queued purge
+const (
+	purgeStatusPending = "pending"
+	purgeStatusFailed  = "failed"
+)
+
+// queuedPurge is a purge that failed and is waiting to be retried
+type queuedPurge struct {
+	ID          string    `json:"id"`
+	Paths       []string  `json:"paths"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	CreatedAt   time.Time `json:"created_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+func purgeQueuePath() string {
+	return dataPath("purge-queue.json")
+}
+
+func loadPurgeQueue() ([]queuedPurge, error) {
+	data, err := os.ReadFile(purgeQueuePath())
+	if os.IsNotExist(err) {
+		return []queuedPurge{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading purge queue: %v", err)
+	}
+
+	var queue []queuedPurge
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return nil, fmt.Errorf("error parsing purge queue: %v", err)
+	}
+	return queue, nil
+}
+
+func savePurgeQueue(queue []queuedPurge) error {
+	data, err := json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializing purge queue: %v", err)
+	}
+	return writeFileAtomic(purgeQueuePath(), data, 0o644)
+}
+
+// purgeRetryDelay returns how long to wait after the given number of attempts
+func purgeRetryDelay(attempts int) time.Duration {
+	delay := purgeRetryBaseDelay
+	for i := 1; i < attempts && delay < purgeRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, purgeRetryMaxDelay)
+}
+
+// purgeOrQueue purges paths and queues them for a retry by the server if the
+// CDN could not be reached. It returns the purge error either way. The
+// caller must hold the data lock.
+func purgeOrQueue(paths ...string) error {
+	err := invalidateCache(paths...)
+	if err == nil || errors.Is(err, errCDNNotConfigured) {
+		return err
+	}
+
+	queue, queueErr := loadPurgeQueue()
+	if queueErr == nil {
+		now := time.Now()
+		queue = append(queue, queuedPurge{
+			ID:          strconv.FormatInt(now.UnixNano(), 10),
+			Paths:       paths,
+			Status:      purgeStatusPending,
+			Attempts:    1,
+			LastError:   err.Error(),
+			CreatedAt:   now,
+			NextAttempt: now.Add(purgeRetryDelay(1)),
+		})
+		queueErr = savePurgeQueue(queue)
+	}
+	if queueErr != nil {
+		log.Printf("Error queueing failed purge for retry: %v", queueErr)
+		return err
+	}
+
+	return fmt.Errorf("%v, queued for retry", err)
+}
+
+// runPurgeRetries retries queued purges as they come due, it never returns
+func runPurgeRetries() {
+	for {
+		if err := retryDuePurges(time.Now()); err != nil {
+			log.Printf("Error retrying queued purges: %v", err)
+		}
+		time.Sleep(purgeRetryPoll)
+	}
+}
+
+// retryDuePurges makes one attempt at every pending purge that is due. The
+// lock is only held while the queue is read and written, not during purges.
+func retryDuePurges(now time.Time) error {
+	// 1. Find the purges that are due
+	var due []queuedPurge
+	err := withDataLock(func() error {
+		queue, err := loadPurgeQueue()
+		if err != nil {
+			return err
+		}
+		for _, purge := range queue {
+			if purge.Status == purgeStatusPending && !purge.NextAttempt.After(now) {
+				due = append(due, purge)
+			}
+		}
+		return nil
+	})
+	if err != nil || len(due) == 0 {
+		return err
+	}
+
+	// 2. Retry them
+	outcomes := make(map[string]error, len(due))
+	for _, purge := range due {
+		outcomes[purge.ID] = invalidateCache(purge.Paths...)
+	}
+
+	// 3. Drop the ones that went through and push back the others
+	return withDataLock(func() error {
+		queue, err := loadPurgeQueue()
+		if err != nil {
+			return err
+		}
+
+		pending, failed := []queuedPurge{}, []queuedPurge{}
+		for _, purge := range queue {
+			purgeErr, retried := outcomes[purge.ID]
+			if retried {
+				if purgeErr == nil {
+					log.Printf("Queued purge of %v succeeded after %d attempts", purge.Paths, purge.Attempts+1)
+					continue
+				}
+
+				purge.Attempts++
+				purge.LastError = purgeErr.Error()
+				purge.NextAttempt = now.Add(purgeRetryDelay(purge.Attempts))
+				if purge.Attempts >= purgeMaxAttempts {
+					log.Printf("Giving up on purge of %v after %d attempts: %v", purge.Paths, purge.Attempts, purgeErr)
+					purge.Status = purgeStatusFailed
+				}
+			}
+
+			if purge.Status == purgeStatusFailed {
+				failed = append(failed, purge)
+			} else {
+				pending = append(pending, purge)
+			}
+		}
+
+		if len(failed) > purgeFailedKept {
+			failed = failed[len(failed)-purgeFailedKept:]
+		}
+		return savePurgeQueue(append(pending, failed...))
+	})
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/viper"
+)
+
+// errCDNNotConfigured is returned when purging is not set up, as opposed to
+// the CDN failing
+var errCDNNotConfigured = errors.New("CDN purging not configured")
+
+// CachePurger drops cached copies of published files from a CDN
+type CachePurger interface {
+	// Purge invalidates the given paths, relative to the CDN URL
+	Purge(paths []string) error
+}
+
+func init() {
+	viper.SetDefault("cdn.provider", "bunny")
+	viper.SetDefault("cdn.cache_tag", "dimagram")
+	viper.SetDefault("cdn.purge_mode", "url")
+}
+
+// purgeByTag reports whether cdn.purge_mode asks for a purge by cache tag or
+// surrogate key instead of one per URL. Whether that reached the changed
+// files depends on the CDN's setup, so they are not reported as purged.
+func purgeByTag() (bool, error) {
+	switch mode := viper.GetString("cdn.purge_mode"); mode {
+	case "url":
+		return false, nil
+	case "tag":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown cdn.purge_mode %q, expected url or tag", mode)
+	}
+}
+
+// purgedPaths returns which of paths a successful purge can be reported for
+func purgedPaths(paths []string) []string {
+	if byTag, err := purgeByTag(); err != nil || byTag {
+		return nil
+	}
+	return paths
+}
+
+// cdnSetting reads key of the CDN config, falling back to legacyEnv, the
+// variable it was configured with when only Bunny was supported
+func cdnSetting(key, legacyEnv string) string {
+	godotenv.Load()
+
+	if value := viper.GetString("cdn." + key); value != "" {
+		return value
+	}
+	if legacyEnv != "" {
+		return os.Getenv(legacyEnv)
+	}
+	return ""
+}
+
+// cdnBaseURL returns the public URL the destination is served from
+func cdnBaseURL() string {
+	return strings.TrimRight(cdnSetting("url", "BUNNY_CDN_URL"), "/")
+}
+
+// newCachePurger returns the CachePurger of the configured CDN provider
+func newCachePurger() (CachePurger, error) {
+	switch provider := viper.GetString("cdn.provider"); provider {
+	case "bunny":
+		return newBunnyPurger()
+	case "cloudflare":
+		return newCloudflarePurger()
+	case "fastly":
+		return newFastlyPurger()
+	case "webhook":
+		return newWebhookPurger()
+	default:
+		return nil, fmt.Errorf("unknown cdn.provider %q, expected bunny, cloudflare, fastly or webhook", provider)
+	}
+}
+
+// apiBaseURL returns cdn.api_url, or fallback when it is not set
+func apiBaseURL(fallback string) string {
+	if base := cdnSetting("api_url", ""); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return fallback
+}
+
+// invalidateCache purges the given paths, relative to the CDN URL, with one
+// call to the configured provider
+func invalidateCache(paths ...string) error {
+	cdnURL := cdnBaseURL()
+	if cdnURL == "" {
+		return fmt.Errorf("%w: CDN URL not set (cdn.url or BUNNY_CDN_URL)", errCDNNotConfigured)
+	}
+
+	purger, err := newCachePurger()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errCDNNotConfigured, err)
+	}
+
+	// All paths go to the provider in one call so it can batch them
+	paths = uniquePaths(paths)
+	if err := purger.Purge(paths); err != nil {
+		return err
+	}
+
+	if len(purgedPaths(paths)) == 0 {
+		log.Printf("Purged the CDN cache by tag for %s, the CDN decides which files that reached", strings.Join(paths, ", "))
+		return nil
+	}
+	log.Printf("Successfully invalidated CDN cache for %s", strings.Join(paths, ", "))
+	return nil
+}
+
+// uniquePaths returns paths without leading slashes and duplicates
+func uniquePaths(paths []string) []string {
+	seen := make(map[string]bool, len(paths))
+	unique := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimLeft(path, "/")
+		if !seen[path] {
+			seen[path] = true
+			unique = append(unique, path)
+		}
+	}
+	return unique
+}
+
+// cdnURLs returns the public URLs of paths
+func cdnURLs(paths []string) []string {
+	cdnURL := cdnBaseURL()
+	urls := make([]string, len(paths))
+	for i, path := range paths {
+		urls[i] = cdnURL + "/" + strings.TrimLeft(path, "/")
+	}
+	return urls
+}
+
+var purgeClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// sendPurgeRequest sends req and turns a non-2xx response into an error
+func sendPurgeRequest(req *http.Request) error {
+	resp, err := purgeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// bunnyPurger purges through the Bunny.net API, one URL per request. With
+// cdn.purge_mode set to tag it instead purges every file of the pull zone in
+// cdn.zone_id tagged with cdn.cache_tag, which the published files carry
+// through their CDN-Tag header.
+type bunnyPurger struct {
+	apiURL   string
+	apiKey   string
+	zoneID   string
+	cacheTag string
+	byTag    bool
+}
+
+func newBunnyPurger() (*bunnyPurger, error) {
+	apiKey := cdnSetting("api_key", "BUNNY_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("required API environment variables not set (BUNNY_API_KEY)")
+	}
+
+	byTag, err := purgeByTag()
+	if err != nil {
+		return nil, err
+	}
+	zoneID := cdnSetting("zone_id", "")
+	if byTag && zoneID == "" {
+		return nil, fmt.Errorf("cdn.zone_id must be set to purge bunny by tag")
+	}
+
+	return &bunnyPurger{
+		apiURL:   apiBaseURL("https://api.bunny.net"),
+		apiKey:   apiKey,
+		zoneID:   zoneID,
+		cacheTag: cdnSetting("cache_tag", ""),
+		byTag:    byTag,
+	}, nil
+}
+
+func (p *bunnyPurger) Purge(paths []string) error {
+	if p.byTag {
+		body, err := json.Marshal(map[string]string{"CacheTag": p.cacheTag})
+		if err != nil {
+			return fmt.Errorf("error serializing purge request: %v", err)
+		}
+		return p.send(p.apiURL+"/pullzone/"+p.zoneID+"/purgeCache", body)
+	}
+
+	// The purge endpoint takes one URL per request
+	for _, purgeURL := range cdnURLs(paths) {
+		if err := p.send(p.apiURL+"/purge?url="+url.QueryEscape(purgeURL), nil); err != nil {
+			return fmt.Errorf("purging %s: %v", purgeURL, err)
+		}
+	}
+	return nil
+}
+
+func (p *bunnyPurger) send(endpoint string, body []byte) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	req.Header.Set("AccessKey", p.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return sendPurgeRequest(req)
+}
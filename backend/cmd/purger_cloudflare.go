@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// cloudflareMaxFiles is how many URLs Cloudflare accepts in one purge request
+const cloudflareMaxFiles = 30
+
+// cloudflarePurger purges URLs from a Cloudflare zone
+type cloudflarePurger struct {
+	apiURL   string
+	apiToken string
+	zoneID   string
+}
+
+func newCloudflarePurger() (*cloudflarePurger, error) {
+	apiToken := cdnSetting("api_key", "")
+	zoneID := cdnSetting("zone_id", "")
+	if apiToken == "" || zoneID == "" {
+		return nil, fmt.Errorf("cdn.api_key and cdn.zone_id must be set for cloudflare")
+	}
+
+	return &cloudflarePurger{
+		apiURL:   apiBaseURL("https://api.cloudflare.com/client/v4"),
+		apiToken: apiToken,
+		zoneID:   zoneID,
+	}, nil
+}
+
+func (p *cloudflarePurger) Purge(paths []string) error {
+	urls := cdnURLs(paths)
+	for start := 0; start < len(urls); start += cloudflareMaxFiles {
+		end := min(start+cloudflareMaxFiles, len(urls))
+
+		body, err := json.Marshal(map[string][]string{"files": urls[start:end]})
+		if err != nil {
+			return fmt.Errorf("error serializing purge request: %v", err)
+		}
+
+		req, err := http.NewRequest("POST", p.apiURL+"/zones/"+p.zoneID+"/purge_cache", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("error creating HTTP request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+p.apiToken)
+
+		if err := sendPurgeRequest(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
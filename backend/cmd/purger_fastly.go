@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// fastlyMaxKeys is how many surrogate keys Fastly accepts in one purge request
+const fastlyMaxKeys = 256
+
+// fastlyPurger purges through the Fastly API, one URL per request. With
+// cdn.purge_mode set to tag it instead purges all paths of the service in
+// cdn.zone_id in one request by surrogate key, which needs the service to
+// tag each response with its path.
+type fastlyPurger struct {
+	apiURL    string
+	apiKey    string
+	serviceID string
+	byTag     bool
+}
+
+func newFastlyPurger() (*fastlyPurger, error) {
+	apiKey := cdnSetting("api_key", "")
+	if apiKey == "" {
+		return nil, fmt.Errorf("cdn.api_key must be set for fastly")
+	}
+
+	byTag, err := purgeByTag()
+	if err != nil {
+		return nil, err
+	}
+	serviceID := cdnSetting("zone_id", "")
+	if byTag && serviceID == "" {
+		return nil, fmt.Errorf("cdn.zone_id must be set to purge fastly by surrogate key")
+	}
+
+	return &fastlyPurger{
+		apiURL:    apiBaseURL("https://api.fastly.com"),
+		apiKey:    apiKey,
+		serviceID: serviceID,
+		byTag:     byTag,
+	}, nil
+}
+
+func (p *fastlyPurger) Purge(paths []string) error {
+	if p.byTag {
+		return p.purgeKeys(paths)
+	}
+
+	for _, purgeURL := range cdnURLs(paths) {
+		// The URL is passed without its scheme, e.g. /purge/www.example.com/today.json
+		target := strings.TrimPrefix(strings.TrimPrefix(purgeURL, "https://"), "http://")
+		if err := p.send(p.apiURL+"/purge/"+target, nil); err != nil {
+			return fmt.Errorf("purging %s: %v", purgeURL, err)
+		}
+	}
+	return nil
+}
+
+// purgeKeys purges the surrogate keys named like the paths
+func (p *fastlyPurger) purgeKeys(paths []string) error {
+	for start := 0; start < len(paths); start += fastlyMaxKeys {
+		end := min(start+fastlyMaxKeys, len(paths))
+		header := http.Header{"Surrogate-Key": {strings.Join(paths[start:end], " ")}}
+		if err := p.send(p.apiURL+"/service/"+p.serviceID+"/purge", header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *fastlyPurger) send(endpoint string, header http.Header) error {
+	req, err := http.NewRequest("POST", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Fastly-Key", p.apiKey)
+	req.Header.Set("Accept", "application/json")
+	return sendPurgeRequest(req)
+}
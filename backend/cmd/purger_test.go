@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// purgeRequest is what a purger sent to the stub API
+type purgeRequest struct {
+	method string
+	uri    string
+	header http.Header
+	body   string
+}
+
+// purgeStub records every request and answers them with 200
+type purgeStub struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []purgeRequest
+}
+
+func newPurgeStub(t *testing.T) *purgeStub {
+	stub := &purgeStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, purgeRequest{r.Method, r.RequestURI, r.Header, string(body)})
+		stub.mu.Unlock()
+		w.Write([]byte(`{"success":true}`))
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// setCDNConfig sets the given cdn settings and restores them after the test
+func setCDNConfig(t *testing.T, settings map[string]string) {
+	for key, value := range settings {
+		key = "cdn." + key
+		previous := viper.GetString(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, previous) })
+	}
+}
+
+func purgeWith(t *testing.T, settings map[string]string, paths []string) {
+	setCDNConfig(t, settings)
+	purger, err := newCachePurger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := purger.Purge(paths); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+}
+
+func checkRequest(t *testing.T, got purgeRequest, method, uri, header, value string) {
+	t.Helper()
+	if got.method != method || got.uri != uri {
+		t.Errorf("request = %s %s, want %s %s", got.method, got.uri, method, uri)
+	}
+	if got.header.Get(header) != value {
+		t.Errorf("%s header = %q, want %q", header, got.header.Get(header), value)
+	}
+}
+
+func checkJSONBody(t *testing.T, got purgeRequest, want any) {
+	t.Helper()
+	body := reflect.New(reflect.TypeOf(want))
+	if err := json.Unmarshal([]byte(got.body), body.Interface()); err != nil {
+		t.Fatalf("body %q: %v", got.body, err)
+	}
+	if !reflect.DeepEqual(body.Elem().Interface(), want) {
+		t.Errorf("body = %s, want %v", got.body, want)
+	}
+}
+
+func TestBunnyPurger(t *testing.T) {
+	t.Run("url", func(t *testing.T) {
+		stub := newPurgeStub(t)
+		purgeWith(t, map[string]string{
+			"provider": "bunny", "url": "https://cdn.example.com", "api_key": "key",
+			"api_url": stub.URL, "zone_id": "42", "purge_mode": "url",
+		}, []string{"today.json", "items/a.json"})
+
+		if len(stub.requests) != 2 {
+			t.Fatalf("got %d requests, want one per URL", len(stub.requests))
+		}
+		for i, path := range []string{"today.json", "items/a.json"} {
+			uri := "/purge?url=" + url.QueryEscape("https://cdn.example.com/"+path)
+			checkRequest(t, stub.requests[i], "POST", uri, "AccessKey", "key")
+			if stub.requests[i].body != "" {
+				t.Errorf("body = %q, want none", stub.requests[i].body)
+			}
+		}
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		stub := newPurgeStub(t)
+		purgeWith(t, map[string]string{
+			"provider": "bunny", "url": "https://cdn.example.com", "api_key": "key",
+			"api_url": stub.URL, "zone_id": "42", "purge_mode": "tag", "cache_tag": "feed",
+		}, []string{"today.json", "items/a.json"})
+
+		if len(stub.requests) != 1 {
+			t.Fatalf("got %d requests, want 1", len(stub.requests))
+		}
+		checkRequest(t, stub.requests[0], "POST", "/pullzone/42/purgeCache", "AccessKey", "key")
+		checkJSONBody(t, stub.requests[0], map[string]string{"CacheTag": "feed"})
+		if purged := purgedPaths([]string{"today.json"}); purged != nil {
+			t.Errorf("purgedPaths() = %v, want none for a purge by tag", purged)
+		}
+	})
+}
+
+func TestCloudflarePurgerBatches(t *testing.T) {
+	stub := newPurgeStub(t)
+	paths := make([]string, 65)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("items/%d.json", i)
+	}
+	purgeWith(t, map[string]string{
+		"provider": "cloudflare", "url": "https://cdn.example.com", "api_key": "token",
+		"api_url": stub.URL, "zone_id": "zone",
+	}, paths)
+
+	if len(stub.requests) != 3 {
+		t.Fatalf("got %d requests, want 3 batches", len(stub.requests))
+	}
+	urls := cdnURLs(paths)
+	for i, want := range [][]string{urls[:30], urls[30:60], urls[60:]} {
+		checkRequest(t, stub.requests[i], "POST", "/zones/zone/purge_cache", "Authorization", "Bearer token")
+		checkJSONBody(t, stub.requests[i], map[string][]string{"files": want})
+	}
+}
+
+func TestFastlyPurger(t *testing.T) {
+	t.Run("url", func(t *testing.T) {
+		stub := newPurgeStub(t)
+		purgeWith(t, map[string]string{
+			"provider": "fastly", "url": "https://cdn.example.com", "api_key": "key",
+			"api_url": stub.URL, "zone_id": "svc", "purge_mode": "url",
+		}, []string{"today.json"})
+
+		if len(stub.requests) != 1 {
+			t.Fatalf("got %d requests, want 1", len(stub.requests))
+		}
+		checkRequest(t, stub.requests[0], "POST", "/purge/cdn.example.com/today.json", "Fastly-Key", "key")
+	})
+
+	t.Run("surrogate key", func(t *testing.T) {
+		stub := newPurgeStub(t)
+		purgeWith(t, map[string]string{
+			"provider": "fastly", "url": "https://cdn.example.com", "api_key": "key",
+			"api_url": stub.URL, "zone_id": "svc", "purge_mode": "tag",
+		}, []string{"today.json", "items/a.json"})
+
+		if len(stub.requests) != 1 {
+			t.Fatalf("got %d requests, want 1", len(stub.requests))
+		}
+		checkRequest(t, stub.requests[0], "POST", "/service/svc/purge", "Fastly-Key", "key")
+		if got := stub.requests[0].header.Get("Surrogate-Key"); got != "today.json items/a.json" {
+			t.Errorf("Surrogate-Key header = %q, want %q", got, "today.json items/a.json")
+		}
+	})
+}
+
+func TestWebhookPurger(t *testing.T) {
+	stub := newPurgeStub(t)
+	purgeWith(t, map[string]string{
+		"provider": "webhook", "url": "https://cdn.example.com", "api_key": "token",
+		"api_url": stub.URL + "/hook",
+	}, []string{"today.json", "items/a.json"})
+
+	if len(stub.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(stub.requests))
+	}
+	checkRequest(t, stub.requests[0], "POST", "/hook", "Authorization", "Bearer token")
+	if got := stub.requests[0].header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type header = %q, want application/json", got)
+	}
+	checkJSONBody(t, stub.requests[0], map[string][]string{
+		"urls": {"https://cdn.example.com/today.json", "https://cdn.example.com/items/a.json"},
+	})
+}
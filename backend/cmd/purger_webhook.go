@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// webhookPurger posts the URLs to purge to an HTTP endpoint, for CDNs
+// without a built in provider or a script that purges several of them
+type webhookPurger struct {
+	webhookURL string
+	token      string
+}
+
+func newWebhookPurger() (*webhookPurger, error) {
+	webhookURL := cdnSetting("api_url", "")
+	if webhookURL == "" {
+		return nil, fmt.Errorf("cdn.api_url must be set to the webhook URL")
+	}
+
+	return &webhookPurger{
+		webhookURL: webhookURL,
+		token:      cdnSetting("api_key", ""),
+	}, nil
+}
+
+func (p *webhookPurger) Purge(paths []string) error {
+	body, err := json.Marshal(map[string][]string{"urls": cdnURLs(paths)})
+	if err != nil {
+		return fmt.Errorf("error serializing purge request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", p.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	return sendPurgeRequest(req)
+}
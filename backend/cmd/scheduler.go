@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
+)
+
+// schedulerState is persisted after every scheduled run so a restarted
+// server knows which slot it handled last
+type schedulerState struct {
+	LastSlot  time.Time `json:"last_slot"`
+	LastRun   time.Time `json:"last_run"`
+	LastItem  ItemID    `json:"last_item,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// scheduler publishes on a cron schedule from inside the server process
+type scheduler struct {
+	store    Store
+	schedule cron.Schedule
+	loc      *time.Location
+
+	mu    sync.Mutex
+	state schedulerState
+	next  time.Time
+}
+
+// publishLoc caches the location of schedule.timezone by its name
+var publishLoc struct {
+	sync.Mutex
+	name string
+	loc  *time.Location
+}
+
+// publishLocation returns the timezone used for the schedule and for
+// deciding which calendar day a publish belongs to, local time if
+// schedule.timezone is empty
+func publishLocation() (*time.Location, error) {
+	name := viper.GetString("schedule.timezone")
+
+	publishLoc.Lock()
+	defer publishLoc.Unlock()
+	if publishLoc.loc != nil && publishLoc.name == name {
+		return publishLoc.loc, nil
+	}
+
+	loc := time.Local
+	if name != "" {
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("invalid schedule.timezone %q: %v", name, err)
+		}
+	}
+	publishLoc.name, publishLoc.loc = name, loc
+	return loc, nil
+}
+
+// newScheduler returns nil when no schedule is configured
+func newScheduler(store Store) (*scheduler, error) {
+	spec := viper.GetString("schedule.cron")
+	if spec == "" {
+		return nil, nil
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule.cron %q: %v", spec, err)
+	}
+
+	loc, err := publishLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scheduler{
+		store:    store,
+		schedule: schedule,
+		loc:      loc,
+	}
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func schedulerStatePath() string {
+	return dataPath("scheduler.json")
+}
+
+func (s *scheduler) loadState() error {
+	data, err := os.ReadFile(schedulerStatePath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading scheduler state: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return fmt.Errorf("error parsing scheduler state: %v", err)
+	}
+	return nil
+}
+
+func (s *scheduler) saveState() error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return fmt.Errorf("error serializing scheduler state: %v", err)
+	}
+	return writeFileAtomic(schedulerStatePath(), data, 0o644)
+}
+
+// run publishes at every scheduled slot, it never returns
+func (s *scheduler) run() {
+	s.mu.Lock()
+	lastSlot := s.state.LastSlot
+	s.mu.Unlock()
+
+	// Catch up once on the latest slot missed while the server was down. On
+	// the very first start there is nothing to catch up on.
+	now := time.Now().In(s.loc)
+	if lastSlot.IsZero() {
+		s.record(now, "", nil)
+	} else if missed := s.latestSlot(lastSlot.In(s.loc), now); !missed.IsZero() {
+		log.Printf("Catching up on scheduled publish missed at %s", missed.Format(time.RFC3339))
+		s.publish(missed)
+	}
+
+	for {
+		next := s.schedule.Next(time.Now().In(s.loc))
+
+		s.mu.Lock()
+		s.next = next
+		s.mu.Unlock()
+
+		log.Printf("Next scheduled publish at %s", next.Format(time.RFC3339))
+		time.Sleep(time.Until(next))
+		s.publish(next)
+	}
+}
+
+// latestSlot returns the last scheduled slot after since and not after now,
+// or the zero time if there is none
+func (s *scheduler) latestSlot(since, now time.Time) time.Time {
+	var latest time.Time
+	for slot := s.schedule.Next(since); !slot.After(now); slot = s.schedule.Next(slot) {
+		latest = slot
+	}
+	return latest
+}
+
+// publish runs the publish pipeline for a slot, the pipeline itself skips
+// days that already have a publish so a catch-up never publishes twice
+func (s *scheduler) publish(slot time.Time) {
+	var item ItemID
+
+	result, err := publishProcess(s.store, publishOptions{})
+	if err != nil {
+		log.Printf("Scheduled publish failed: %v", err)
+	} else if result.AlreadyPublished {
+		log.Printf("Skipping scheduled publish, item %s was already published on %s", result.Item.ID, publishDay(slot))
+	} else {
+		item = result.Item.ID
+	}
+
+	s.record(slot, item, err)
+}
+
+// record persists the outcome of the run for slot
+func (s *scheduler) record(slot time.Time, item ItemID, runErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.LastSlot = slot
+	s.state.LastRun = time.Now()
+	s.state.LastItem = item
+	s.state.LastError = ""
+	if runErr != nil {
+		s.state.LastError = runErr.Error()
+	}
+	if err := s.saveState(); err != nil {
+		log.Printf("Warning: Failed to save scheduler state: %v", err)
+	}
+}
+
+// status describes the schedule for /api/schedule
+func (s *scheduler) status() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return map[string]interface{}{
+		"enabled":  true,
+		"cron":     viper.GetString("schedule.cron"),
+		"timezone": s.loc.String(),
+		"next_run": s.next,
+		"state":    s.state,
+	}
+}
@@ -1,32 +1,20 @@
 package cmd
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strconv"
 	"time"
 
-	"github.com/joho/godotenv"
-	"github.com/pkg/sftp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/crypto/ssh"
 )
 
-type AlbumItem struct {
-	ID          interface{} `json:"id"`
-	URL         string      `json:"url"`
-	Description string      `json:"description"`
-	Credits     string      `json:"credits"`
-}
-
 var port string
 
 var serverCmd = &cobra.Command{
@@ -59,91 +47,42 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func publishProcess() error {
-	// 1. Parse album.json
-	albumPath := filepath.Join("data", "album.json")
-	albumFile, err := os.ReadFile(albumPath)
-	if err != nil {
-		return fmt.Errorf("error reading album.json: %v", err)
-	}
-
-	var albumItems []AlbumItem
-	if err := json.Unmarshal(albumFile, &albumItems); err != nil {
-		return fmt.Errorf("error parsing album.json: %v", err)
-	}
-
-	if len(albumItems) == 0 {
-		return fmt.Errorf("no items in album.json")
-	}
-
-	// 2. Get the first item
-	firstItem := albumItems[0]
-	log.Printf("Publishing item: %v with URL: %s\n", firstItem.ID, firstItem.URL)
-
-	// 3. Upload item to SFTP server
-	if err := uploadToSFTP(firstItem); err != nil {
-		return fmt.Errorf("error uploading to SFTP server: %v", err)
-	}
-
-	// 4. Invalidate CDN cache
-	if err := invalidateCache(); err != nil {
-		log.Printf("Warning: Failed to invalidate CDN cache: %v\n", err)
-		// Continue execution even if cache invalidation fails
-	}
-
-	// 5. Append the item to data/archive.json
-	archivePath := filepath.Join("data", "archive.json")
-	var archiveItems []AlbumItem
+func startServer() {
+	// Configure logging
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.LstdFlags)
 
-	// Read existing archive.json if it exists
-	archiveFile, err := os.ReadFile(archivePath)
-	if err == nil {
-		// File exists, parse it
-		if err := json.Unmarshal(archiveFile, &archiveItems); err != nil {
-			return fmt.Errorf("error parsing archive.json: %v", err)
-		}
-	} else if !os.IsNotExist(err) {
-		// Error other than file not existing
-		return fmt.Errorf("error reading archive.json: %v", err)
+	// Create data directory if it doesn't exist
+	if err := os.MkdirAll(dataDir(), 0o755); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
-	// Append the item
-	archiveItems = append(archiveItems, firstItem)
-
-	// Write back to archive.json
-	archiveData, err := json.Marshal(archiveItems)
+	// Open the store selected by store.driver
+	store, err := openStore()
 	if err != nil {
-		return fmt.Errorf("error serializing archive data: %v", err)
+		log.Fatalf("Failed to open store: %v", err)
 	}
+	defer store.Close()
 
-	if err := os.WriteFile(archivePath, archiveData, 0o644); err != nil {
-		return fmt.Errorf("error writing to archive.json: %v", err)
+	// Repair a publish that was interrupted by a crash or restart
+	err = withDataLock(func() error {
+		return recoverPublishJournal(store)
+	})
+	if err != nil {
+		log.Printf("Failed to recover interrupted publish, retrying on next publish: %v", err)
 	}
 
-	// 6. Delete the item from data/album.json
-	albumItems = albumItems[1:]
-	albumData, err := json.Marshal(albumItems)
+	// Start the built-in publish scheduler if schedule.cron is set
+	sched, err := newScheduler(store)
 	if err != nil {
-		return fmt.Errorf("error serializing album data: %v", err)
+		log.Fatalf("Failed to set up scheduler: %v", err)
 	}
-
-	if err := os.WriteFile(albumPath, albumData, 0o644); err != nil {
-		return fmt.Errorf("error writing to album.json: %v", err)
+	if sched != nil {
+		go sched.run()
 	}
 
-	log.Println("Successfully published the image, uploaded to SFTP, invalidated cache, archived the item, and updated album.")
-	return nil
-}
-
-func startServer() {
-	// Configure logging
-	log.SetOutput(os.Stdout)
-	log.SetFlags(log.LstdFlags)
-
-	// Create data directory if it doesn't exist
-	if err := os.MkdirAll("data", 0o755); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
-	}
+	// Retry CDN purges that failed during a publish
+	go runPurgeRetries()
 
 	// Create a custom ServeMux for routing
 	mux := http.NewServeMux()
@@ -152,7 +91,8 @@ func startServer() {
 	mux.HandleFunc("/api/album", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		// Handle OPTIONS request (preflight)
 		if r.Method == "OPTIONS" {
@@ -160,53 +100,91 @@ func startServer() {
 			return
 		}
 
-		// GET request - return the album.json file
+		// GET request - return the album queue
 		if r.Method == "GET" {
-			albumPath := filepath.Join("data", "album.json")
-
-			// Check if file exists
-			if _, err := os.Stat(albumPath); os.IsNotExist(err) {
-				// Return empty JSON if file doesn't exist
-				w.Header().Set("Content-Type", "application/json")
-				w.Write([]byte("{}"))
+			albumItems, err := store.Queue()
+			if err != nil {
+				http.Error(w, "Failed to read album", http.StatusInternalServerError)
+				log.Printf("Failed to read album: %v", err)
 				return
 			}
 
-			// Open and return the file
-			albumFile, err := os.Open(albumPath)
-			if err != nil {
-				http.Error(w, "Failed to open album file", http.StatusInternalServerError)
-				log.Printf("Failed to open album file: %v", err)
+			// Return an empty list rather than null for an empty album
+			if albumItems == nil {
+				albumItems = []AlbumItem{}
+			}
+
+			// Tag the response so the client can send it back with If-Match
+			etag := albumETag(albumItems)
+			w.Header().Set("ETag", etag)
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
 				return
 			}
-			defer albumFile.Close()
 
 			w.Header().Set("Content-Type", "application/json")
-			io.Copy(w, albumFile)
+			json.NewEncoder(w).Encode(albumItems)
 			return
 		}
 
-		// POST request - save the album.json file
+		// POST request - replace the album queue
 		if r.Method == "POST" {
-			albumPath := filepath.Join("data", "album.json")
+			// Parse the whole body first so a failed request can't truncate the album
+			var albumItems []AlbumItem
+			if err := decodeJSONBody(r, &albumItems); err != nil {
+				writeRequestError(w, err)
+				log.Printf("Failed to parse album data: %v", err)
+				return
+			}
 
-			// Create or truncate the album file
-			albumFile, err := os.Create(albumPath)
-			if err != nil {
-				http.Error(w, "Failed to create album file", http.StatusInternalServerError)
-				log.Printf("Failed to create album file: %v", err)
+			// Items added by older clients come without an ID
+			assignItemIDs(albumItems)
+
+			// Refuse to persist anything the publisher can't handle
+			if errs := validateAlbum(albumItems); len(errs) > 0 {
+				writeRequestError(w, errs)
 				return
 			}
-			defer albumFile.Close()
 
-			// Copy request body to file without parsing
-			_, err = io.Copy(albumFile, r.Body)
-			if err != nil {
+			// Replace the album while holding the data lock, unless it changed
+			// since the client read the version given in If-Match. Without it a
+			// client could bring back items that were published meanwhile,
+			// "*" overwrites whatever is there on purpose.
+			ifMatch := r.Header.Get("If-Match")
+			if ifMatch == "" {
+				writeJSON(w, http.StatusPreconditionRequired, map[string]string{
+					"error": errAlbumETagRequired.Error(),
+				})
+				return
+			}
+			var currentETag string
+			err := withDataLock(func() error {
+				if ifMatch != "*" {
+					currentItems, err := store.Queue()
+					if err != nil {
+						return err
+					}
+					currentETag = albumETag(currentItems)
+					if !etagMatches(ifMatch, currentETag) {
+						return errStaleAlbum
+					}
+				}
+				return store.SaveQueue(albumItems)
+			})
+			if errors.Is(err, errStaleAlbum) {
+				w.Header().Set("ETag", currentETag)
+				writeJSON(w, http.StatusPreconditionFailed, map[string]string{
+					"error": err.Error(),
+				})
+				return
+			} else if err != nil {
 				http.Error(w, "Failed to write album data", http.StatusInternalServerError)
 				log.Printf("Failed to write album data: %v", err)
 				return
 			}
 
+			w.Header().Set("ETag", albumETag(albumItems))
+			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte(`{"status":"ok"}`))
 			return
@@ -216,6 +194,11 @@ func startServer() {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	})
 
+	// Per-item album endpoints
+	mux.HandleFunc("/api/album/items", albumItemsHandler(store))
+	mux.HandleFunc("/api/album/items/{id}", albumItemHandler(store))
+	mux.HandleFunc("/api/album/reorder", albumReorderHandler(store))
+
 	// Add publish endpoint
 	mux.HandleFunc("/api/publish", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
@@ -235,16 +218,94 @@ func startServer() {
 		}
 
 		// Run the publish process
-		err := publishProcess()
+		result, err := publishProcess(store, publishOptions{
+			DryRun: r.URL.Query().Get("dry_run") == "true",
+			ItemID: r.URL.Query().Get("item"),
+			Force:  r.URL.Query().Get("force") == "true",
+		})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, errItemNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, errDayTaken):
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
 			log.Printf("Publish failed: %v", err)
 			return
 		}
 
+		// A retried request for a day that is already published is not an error
+		if result.AlreadyPublished {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"status":            "already_published",
+				"message":           "An item was already published today, use ?force=true to publish another one",
+				"item":              result.Item,
+				"already_published": true,
+			})
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok","message":"Successfully published"}`))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":       "ok",
+			"message":      "Successfully published",
+			"item":         result.Item,
+			"dry_run":      result.DryRun,
+			"uploaded":     result.Uploaded,
+			"purged":       result.Purged,
+			"archived":     result.Archived,
+			"destinations": result.Destinations,
+		})
+	})
+
+	// Add schedule status endpoint
+	mux.HandleFunc("/api/schedule", func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, "GET, OPTIONS")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if sched == nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": false})
+			return
+		}
+		writeJSON(w, http.StatusOK, sched.status())
+	})
+
+	// Add purge queue status endpoint
+	mux.HandleFunc("/api/purges", func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, "GET, OPTIONS")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var queue []queuedPurge
+		err := withDataLock(func() error {
+			var err error
+			queue, err = loadPurgeQueue()
+			return err
+		})
+		if err != nil {
+			http.Error(w, "Error reading purge queue", http.StatusInternalServerError)
+			log.Printf("Error reading purge queue: %v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"purges": queue})
 	})
 
 	// Serve static files from frontend directory
@@ -269,9 +330,23 @@ func startServer() {
 			return
 		}
 
-		// Max upload size of 10MB
-		r.ParseMultipartForm(10 << 20)
-		
+		// Cap the request body, a larger upload fails while it is read instead
+		// of filling up the temp dir
+		maxSize := maxUploadSize()
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+					"error": fmt.Sprintf("file too large, the limit is %d bytes", maxSize),
+				})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid upload form: %v", err)})
+			log.Printf("Error parsing upload form: %v", err)
+			return
+		}
+
 		// Get the file from the request
 		file, handler, err := r.FormFile("file")
 		if err != nil {
@@ -281,17 +356,40 @@ func startServer() {
 		}
 		defer file.Close()
 
+		if handler.Size > maxSize {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+				"error": fmt.Sprintf("file too large, the limit is %d bytes", maxSize),
+			})
+			return
+		}
+
 		// Create uploads directory if it doesn't exist
-		uploadDir := "data/uploads"
+		uploadDir := dataPath("uploads")
 		if err := os.MkdirAll(uploadDir, 0o755); err != nil {
 			http.Error(w, "Error creating upload directory", http.StatusInternalServerError)
 			log.Printf("Error creating upload directory: %v", err)
 			return
 		}
 
-		// Get file extension from original filename
-		fileExt := filepath.Ext(handler.Filename)
-		
+		// Check the content is an image of an allowed type, the extension is
+		// taken from the detected type rather than the client's filename
+		imgInfo, err := sniffImage(file)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, errUnsupportedImage):
+				status = http.StatusUnsupportedMediaType
+			case errors.Is(err, errInvalidImage):
+				status = http.StatusUnprocessableEntity
+			case errors.Is(err, errImageTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			log.Printf("Rejected upload %q: %v", handler.Filename, err)
+			return
+		}
+		fileExt := imgInfo.Ext
+
 		// Create a temporary filename and path - will be renamed after hash is calculated
 		tempFilename := fmt.Sprintf("temp-%d%s", time.Now().UnixNano(), fileExt)
 		filePath := fmt.Sprintf("%s/%s", uploadDir, tempFilename)
@@ -312,7 +410,8 @@ func startServer() {
 		writer := io.MultiWriter(dst, hasher)
 		
 		// Copy data from source to both the file and hasher
-		if _, err := io.Copy(writer, file); err != nil {
+		fileSize, err := io.Copy(writer, file)
+		if err != nil {
 			http.Error(w, "Error saving file on server", http.StatusInternalServerError)
 			log.Printf("Error saving file: %v", err)
 			return
@@ -343,25 +442,116 @@ func startServer() {
 			}
 		}
 		
-		// Upload the file to SFTP
-		if err := uploadFileToSFTP(filePath, filename); err != nil {
-			http.Error(w, "Error uploading file to SFTP", http.StatusInternalServerError)
-			log.Printf("Error uploading to SFTP: %v", err)
-			return
+		// Phones store photos the way the sensor took them and record in EXIF
+		// how they are turned, the dimensions are those as displayed
+		imgInfo = imgInfo.oriented(readOrientation(filePath, imgInfo))
+
+		// Read the camera details and authorship, they are optional so an
+		// image without them is uploaded all the same
+		photo := readPhotoMetadata(filePath, imgInfo)
+
+		// Skip the upload if a file with the same hash was uploaded before and
+		// is still at every destination
+		var destinations []destinationResult
+		deduplicated := false
+		known, err := store.FindUpload(hashString)
+		if err != nil {
+			log.Printf("Warning: Failed to look up upload: %v", err)
+		}
+		if known != nil {
+			destinations, deduplicated = contentFileExists(known.Filename, fileSize)
 		}
 
-		// Get CDN URL from environment
-		godotenv.Load()
-		cdnURL := os.Getenv("BUNNY_CDN_URL")
+		// Create the resized variants before anything is uploaded, decoding the
+		// whole image also rejects files with broken pixel data. The variants
+		// of a deduplicated upload are reused if they are all still there.
+		var variants []imageVariant
+		reused := false
+		if deduplicated {
+			variants, reused = existingVariants(hashString, imgInfo)
+		}
+		if !reused {
+			variants, err = createVariants(filePath, hashString, imgInfo, uploadDir)
+			if err != nil {
+				if errors.Is(err, errInvalidImage) {
+					writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+					log.Printf("Rejected upload %q: %v", handler.Filename, err)
+					return
+				}
+				http.Error(w, "Error creating image variants", http.StatusInternalServerError)
+				log.Printf("Error creating image variants: %v", err)
+				return
+			}
+			defer removeVariants(variants)
+		}
+		if variants == nil {
+			variants = []imageVariant{}
+		}
+
+		if deduplicated {
+			filename = known.Filename
+			log.Printf("File '%s' was already uploaded, skipping upload", filename)
+		} else {
+			// Upload the file to the publishing destinations
+			destinations, err = uploadContentFile(filePath, filename)
+			if err != nil {
+				http.Error(w, "Error uploading file", http.StatusInternalServerError)
+				log.Printf("Error uploading file: %v", err)
+				return
+			}
+		}
+
+		// Get the public CDN URL from config
+		cdnURL := cdnBaseURL()
 		if cdnURL == "" {
 			cdnURL = "https://example.com" // Fallback if not set
 		}
 
 		// Return the URL for the uploaded file
 		imageURL := fmt.Sprintf("%s/content/%s", cdnURL, filename)
+
+		// Upload the variants that aren't at every destination yet, they are
+		// checked on their own since an older upload may have other widths
+		for i, variant := range variants {
+			if !reused {
+				if _, exists := contentFileExists(variant.Filename, variant.size); !exists {
+					if _, err := uploadContentFile(variant.path, variant.Filename); err != nil {
+						http.Error(w, "Error uploading image variants", http.StatusInternalServerError)
+						log.Printf("Error uploading variant %s: %v", variant.Filename, err)
+						return
+					}
+				}
+			}
+			variants[i].URL = fmt.Sprintf("%s/content/%s", cdnURL, variant.Filename)
+		}
+
+		// Remember the upload in the store's upload index
+		if !deduplicated {
+			err = withDataLock(func() error {
+				return store.AddUpload(UploadRecord{
+					Hash:       hashString,
+					Filename:   filename,
+					URL:        imageURL,
+					Size:       fileSize,
+					UploadedAt: time.Now(),
+				})
+			})
+			if err != nil {
+				log.Printf("Warning: Failed to record upload: %v", err)
+			}
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"url": imageURL,
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"url":          imageURL,
+			"deduplicated": deduplicated,
+			"destinations": destinations,
+			"content_type": imgInfo.ContentType,
+			"width":        imgInfo.Width,
+			"height":       imgInfo.Height,
+			"variants":     variants,
+			"srcset":       variantSrcset(imageURL, imgInfo.Width, variants),
+			"photo":        photo,
+			"credits":      photo.credits(),
 		})
 	})
 
@@ -377,228 +567,3 @@ func startServer() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
-
-func uploadToSFTP(item AlbumItem) error {
-	godotenv.Load()
-
-	// Get SFTP credentials from environment
-	host := os.Getenv("SFTP_HOST")
-	portStr := os.Getenv("SFTP_PORT")
-	user := os.Getenv("SFTP_USER")
-	password := os.Getenv("SFTP_PASSWORD")
-	keyPath := os.Getenv("SFTP_PRIVATE_KEY_PATH")
-
-	// Validate required environment variables
-	if host == "" || user == "" || (password == "" && keyPath == "") {
-		return fmt.Errorf("required SFTP environment variables not set")
-	}
-
-	// Default port is 22 if not specified
-	port := 22
-	if portStr != "" {
-		var err error
-		port, err = strconv.Atoi(portStr)
-		if err != nil {
-			return fmt.Errorf("invalid SFTP port: %v", err)
-		}
-	}
-
-	// Configure SSH client
-	var authMethods []ssh.AuthMethod
-	if password != "" {
-		authMethods = append(authMethods, ssh.Password(password))
-	} else if keyPath != "" {
-		key, err := os.ReadFile(keyPath)
-		if err != nil {
-			return fmt.Errorf("unable to read private key: %v", err)
-		}
-
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return fmt.Errorf("unable to parse private key: %v", err)
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	}
-
-	config := &ssh.ClientConfig{
-		User:            user,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Note: This is not secure for production
-		Timeout:         15 * time.Second,
-	}
-
-	// Connect to SFTP server
-	addr := fmt.Sprintf("%s:%d", host, port)
-	sshClient, err := ssh.Dial("tcp", addr, config)
-	if err != nil {
-		return fmt.Errorf("failed to connect to SSH server: %v", err)
-	}
-	defer sshClient.Close()
-
-	// Create SFTP client
-	sftpClient, err := sftp.NewClient(sshClient)
-	if err != nil {
-		return fmt.Errorf("failed to create SFTP client: %v", err)
-	}
-	defer sftpClient.Close()
-
-	// Create JSON content to upload
-	content, err := json.Marshal(item)
-	if err != nil {
-		return fmt.Errorf("error serializing item data: %v", err)
-	}
-
-	// Create a file on the SFTP server
-	remoteFile, err := sftpClient.Create("today.json")
-	if err != nil {
-		return fmt.Errorf("failed to create remote file: %v", err)
-	}
-	defer remoteFile.Close()
-
-	// Write JSON content to the file
-	_, err = remoteFile.Write(content)
-	if err != nil {
-		return fmt.Errorf("failed to write to remote file: %v", err)
-	}
-
-	log.Println("Successfully uploaded item to SFTP server as 'today.json'")
-	return nil
-}
-
-func invalidateCache() error {
-	godotenv.Load()
-
-	// Get API credentials from environment
-	apiKey := os.Getenv("BUNNY_API_KEY")
-	cdnURL := os.Getenv("BUNNY_CDN_URL")
-
-	// Validate required environment variables
-	if apiKey == "" || cdnURL == "" {
-		return fmt.Errorf("required API environment variables not set (BUNNY_API_KEY, BUNNY_CDN_URL)")
-	}
-
-	// Construct purge URL for the "today" file
-	purgeURL := fmt.Sprintf("https://api.bunny.net/purge?url=%s/today.json", cdnURL)
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", purgeURL, bytes.NewBuffer([]byte{}))
-	if err != nil {
-		return fmt.Errorf("error creating HTTP request: %v", err)
-	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("AccessKey", apiKey)
-
-	// Send request
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error sending HTTP request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Check response
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-	}
-
-	log.Println("Successfully invalidated CDN cache for 'today.json' file")
-	return nil
-}
-
-func uploadFileToSFTP(localFilePath, remoteFileName string) error {
-	godotenv.Load()
-
-	// Get SFTP credentials from environment
-	host := os.Getenv("SFTP_HOST")
-	portStr := os.Getenv("SFTP_PORT")
-	user := os.Getenv("SFTP_USER")
-	password := os.Getenv("SFTP_PASSWORD")
-	keyPath := os.Getenv("SFTP_PRIVATE_KEY_PATH")
-
-	// Validate required environment variables
-	if host == "" || user == "" || (password == "" && keyPath == "") {
-		return fmt.Errorf("required SFTP environment variables not set")
-	}
-
-	// Default port is 22 if not specified
-	port := 22
-	if portStr != "" {
-		var err error
-		port, err = strconv.Atoi(portStr)
-		if err != nil {
-			return fmt.Errorf("invalid SFTP port: %v", err)
-		}
-	}
-
-	// Configure SSH client
-	var authMethods []ssh.AuthMethod
-	if password != "" {
-		authMethods = append(authMethods, ssh.Password(password))
-	} else if keyPath != "" {
-		key, err := os.ReadFile(keyPath)
-		if err != nil {
-			return fmt.Errorf("unable to read private key: %v", err)
-		}
-
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return fmt.Errorf("unable to parse private key: %v", err)
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	}
-
-	config := &ssh.ClientConfig{
-		User:            user,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Note: This is not secure for production
-		Timeout:         15 * time.Second,
-	}
-
-	// Connect to SFTP server
-	addr := fmt.Sprintf("%s:%d", host, port)
-	sshClient, err := ssh.Dial("tcp", addr, config)
-	if err != nil {
-		return fmt.Errorf("failed to connect to SSH server: %v", err)
-	}
-	defer sshClient.Close()
-
-	// Create SFTP client
-	sftpClient, err := sftp.NewClient(sshClient)
-	if err != nil {
-		return fmt.Errorf("failed to create SFTP client: %v", err)
-	}
-	defer sftpClient.Close()
-
-	// Open local file
-	localFile, err := os.Open(localFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to open local file: %v", err)
-	}
-	defer localFile.Close()
-
-	// Ensure content directory exists on remote server
-	contentDir := "content"
-	sftpClient.MkdirAll(contentDir)
-
-	// Create a file on the SFTP server in the content directory
-	remoteFilePath := fmt.Sprintf("%s/%s", contentDir, remoteFileName)
-	remoteFile, err := sftpClient.Create(remoteFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create remote file: %v", err)
-	}
-	defer remoteFile.Close()
-
-	// Copy local file to remote
-	_, err = io.Copy(remoteFile, localFile)
-	if err != nil {
-		return fmt.Errorf("failed to write to remote file: %v", err)
-	}
-
-	log.Printf("Successfully uploaded file to SFTP server at '%s'", remoteFilePath)
-	return nil
-}
\ No newline at end of file
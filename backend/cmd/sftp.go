@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	sftpTrustDestination string
+	sftpTrustReplace     bool
+)
+
+// errHostKeyCaptured ends the handshake of `sftp trust` once the server has
+// shown its key, no login is needed to record it
+var errHostKeyCaptured = errors.New("host key captured")
+
+var sftpCmd = &cobra.Command{
+	Use:   "sftp",
+	Short: "Manage SFTP destinations",
+}
+
+var sftpTrustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Record the host key of an SFTP destination",
+	Long: `Connect to an SFTP destination, print its host key fingerprint and record the key in the destination's known_hosts file (data/known_hosts unless known_hosts is set).
+
+Compare the fingerprint with the one your storage provider publishes. If a different key is already recorded nothing is changed unless --replace is given.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := trustSFTPHostKey(destinationPrefix(sftpTrustDestination), sftpTrustReplace); err != nil {
+			fmt.Printf("Error trusting host key: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// GetSFTPCmd returns the sftp command
+func GetSFTPCmd() *cobra.Command {
+	return sftpCmd
+}
+
+func init() {
+	sftpTrustCmd.Flags().StringVar(&sftpTrustDestination, "destination", "default", "Name of the destination in publish.destinations")
+	sftpTrustCmd.Flags().BoolVar(&sftpTrustReplace, "replace", false, "Replace a different key that is already recorded for the host")
+	sftpCmd.AddCommand(sftpTrustCmd)
+}
+
+func trustSFTPHostKey(prefix string, replace bool) error {
+	godotenv.Load()
+
+	addr, err := sftpAddr(prefix)
+	if err != nil {
+		return err
+	}
+
+	// 1. Fetch the key the server presents, of a type that is recorded
+	// already unless it is being replaced
+	path := knownHostsPath(prefix)
+	var algorithms []string
+	if !replace {
+		if algorithms, err = knownHostKeyAlgorithms(path, addr); err != nil {
+			return err
+		}
+	}
+	var key ssh.PublicKey
+	var remote net.Addr
+	_, err = ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User: "dimagram",
+		HostKeyCallback: func(hostname string, r net.Addr, k ssh.PublicKey) error {
+			key, remote = k, r
+			return errHostKeyCaptured
+		},
+		HostKeyAlgorithms: algorithms,
+		Timeout:           15 * time.Second,
+	})
+	if key == nil {
+		return fmt.Errorf("failed to get host key of %s: %v", addr, err)
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	fmt.Printf("%s presents a %s key with fingerprint %s\n", addr, key.Type(), fingerprint)
+
+	// 2. Compare it with what is recorded already
+	if check, err := knownhosts.New(path); err == nil {
+		err = check(addr, remote, key)
+		var keyErr *knownhosts.KeyError
+		switch {
+		case err == nil:
+			fmt.Printf("The key is already trusted in %s\n", path)
+			return nil
+		case errors.As(err, &keyErr) && len(keyErr.Want) > 0 && !replace:
+			return fmt.Errorf("%s has a different key for %s (%s), run with --replace if the server's key really changed",
+				path, addr, ssh.FingerprintSHA256(keyErr.Want[0].Key))
+		case errors.As(err, &keyErr):
+			// An unknown host, or a changed key that is being replaced
+		default:
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	// 3. Record it, dropping older keys of the host when replacing
+	host := knownhosts.Normalize(addr)
+	var lines []string
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			if fields := strings.Fields(line); replace && len(fields) > 0 && slices.Contains(strings.Split(fields[0], ","), host) {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, knownhosts.Line([]string{host}, key))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+
+	fmt.Printf("Trusted the key in %s\n", path)
+	return nil
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// defaultSFTPAuthOrder is the order auth methods are tried in unless
+// <prefix>.auth_order says otherwise
+var defaultSFTPAuthOrder = []string{"key", "agent", "password"}
+
+// sftpAuthMethods returns the SSH auth methods configured for the destination
+// under prefix, in the order of <prefix>.auth_order. Every method that is
+// configured is tried until one is accepted:
+//
+//   - key: the private key at private_key_path, decrypted with
+//     private_key_passphrase if needed, together with its OpenSSH certificate
+//     from certificate_path or <private_key_path>-cert.pub
+//   - agent: the keys and certificates held by the ssh-agent at agent_socket
+//     or SSH_AUTH_SOCK
+//   - password: password, also answered to keyboard-interactive prompts
+func sftpAuthMethods(prefix string) ([]ssh.AuthMethod, error) {
+	order := defaultSFTPAuthOrder
+	if value := destinationSetting(prefix, "auth_order", ""); value != "" {
+		order = splitList(value)
+	}
+
+	// SSH clients try each method name only once, so the keys from the file
+	// and from the agent are offered through a single publickey method
+	var methods []ssh.AuthMethod
+	var sources []func() ([]ssh.Signer, error)
+	addPublicKeys := func(source func() ([]ssh.Signer, error)) {
+		if len(sources) == 0 {
+			methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				var signers []ssh.Signer
+				for _, source := range sources {
+					s, err := source()
+					if err != nil {
+						log.Printf("Warning: Skipping SSH keys: %v", err)
+						continue
+					}
+					signers = append(signers, s...)
+				}
+				return signers, nil
+			}))
+		}
+		sources = append(sources, source)
+	}
+
+	for _, name := range order {
+		switch name {
+		case "key":
+			keyPath := destinationSetting(prefix, "private_key_path", "SFTP_PRIVATE_KEY_PATH")
+			if keyPath == "" {
+				continue
+			}
+			// Load the key right away so a wrong path or passphrase is reported
+			// before the first upload
+			signers, err := loadSFTPKey(prefix, keyPath)
+			if err != nil {
+				return nil, err
+			}
+			addPublicKeys(func() ([]ssh.Signer, error) { return signers, nil })
+
+		case "agent":
+			socket := destinationSetting(prefix, "agent_socket", "SSH_AUTH_SOCK")
+			if socket == "" {
+				continue
+			}
+			addPublicKeys((&sshAgent{socket: socket}).signers)
+
+		case "password":
+			password := destinationSetting(prefix, "password", "SFTP_PASSWORD")
+			if password == "" {
+				continue
+			}
+			methods = append(methods,
+				ssh.Password(password),
+				ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+					answers := make([]string, len(questions))
+					for i := range answers {
+						answers[i] = password
+					}
+					return answers, nil
+				}),
+			)
+
+		default:
+			return nil, fmt.Errorf("unknown SSH auth method %q in %s.auth_order, expected key, agent or password", name, prefix)
+		}
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no SFTP auth configured, set a password, a private key or SSH_AUTH_SOCK")
+	}
+	return methods, nil
+}
+
+// loadSFTPKey reads the private key at keyPath and returns its signer,
+// preceded by a certificate signer if the key has a certificate
+func loadSFTPKey(prefix, keyPath string) ([]ssh.Signer, error) {
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %v", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase := destinationSetting(prefix, "private_key_passphrase", "SFTP_PRIVATE_KEY_PASSPHRASE")
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key %s is encrypted, set %s.private_key_passphrase", keyPath, prefix)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %v", err)
+	}
+
+	// A certificate next to the key is used like OpenSSH does
+	certPath := destinationSetting(prefix, "certificate_path", "SFTP_CERTIFICATE_PATH")
+	if certPath == "" {
+		if _, err := os.Stat(keyPath + "-cert.pub"); err != nil {
+			return []ssh.Signer{signer}, nil
+		}
+		certPath = keyPath + "-cert.pub"
+	}
+
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read certificate: %v", err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate: %v", err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an SSH certificate", certPath)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s does not match the private key: %v", certPath, err)
+	}
+	return []ssh.Signer{certSigner, signer}, nil
+}
+
+// sshAgent fetches signers from an ssh-agent. One client is kept per
+// connection because the agent protocol doesn't allow interleaved requests,
+// the signers always sign through the current one so reconnecting after the
+// agent went away doesn't break signers handed out before.
+type sshAgent struct {
+	socket string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	client agent.ExtendedAgent
+}
+
+// agent returns the client of the current connection, connecting if needed
+func (a *sshAgent) agent() (agent.ExtendedAgent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.client == nil {
+		conn, err := net.Dial("unix", a.socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh-agent: %v", err)
+		}
+		a.conn = conn
+		a.client = agent.NewClient(conn)
+	}
+	return a.client, nil
+}
+
+// reset closes the connection of client unless it was already replaced
+func (a *sshAgent) reset(client agent.ExtendedAgent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.client == client {
+		a.conn.Close()
+		a.conn = nil
+		a.client = nil
+	}
+}
+
+func (a *sshAgent) signers() ([]ssh.Signer, error) {
+	for attempt := 1; ; attempt++ {
+		client, err := a.agent()
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := client.List()
+		if err != nil {
+			a.reset(client)
+			if attempt > 1 {
+				return nil, fmt.Errorf("failed to list ssh-agent keys: %v", err)
+			}
+			continue
+		}
+
+		signers := make([]ssh.Signer, 0, len(keys))
+		for _, key := range keys {
+			pub, err := ssh.ParsePublicKey(key.Blob)
+			if err != nil {
+				// Keys of types this client doesn't know are left out
+				continue
+			}
+			signers = append(signers, &agentSigner{agent: a, pub: pub})
+		}
+		return signers, nil
+	}
+}
+
+// agentSigner signs with a key held by the ssh-agent
+type agentSigner struct {
+	agent *sshAgent
+	pub   ssh.PublicKey
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.pub
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+// SignWithAlgorithm lets RSA keys sign with SHA-2, the agent has its own
+// entropy so rand is not used
+func (s *agentSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	var flags agent.SignatureFlags
+	switch algorithm {
+	case ssh.KeyAlgoRSASHA256:
+		flags = agent.SignatureFlagRsaSha256
+	case ssh.KeyAlgoRSASHA512:
+		flags = agent.SignatureFlagRsaSha512
+	}
+
+	client, err := s.agent.agent()
+	if err != nil {
+		return nil, err
+	}
+	return client.SignWithFlags(s.pub, data, flags)
+}
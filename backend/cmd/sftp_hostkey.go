@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// knownHostsPath returns the known_hosts file of the SFTP destination under
+// prefix, by default it lives in the data dir next to the rest of the state
+func knownHostsPath(prefix string) string {
+	if path := destinationSetting(prefix, "known_hosts", "SFTP_KNOWN_HOSTS"); path != "" {
+		return path
+	}
+	return dataPath("known_hosts")
+}
+
+// sftpHostKeyCallback verifies the server's host key against the fingerprint
+// pinned in <prefix>.host_key_fingerprint or else against the known_hosts file.
+// It also returns the path of that file, empty when it is not used.
+func sftpHostKeyCallback(prefix string) (ssh.HostKeyCallback, string, error) {
+	if value := destinationSetting(prefix, "host_key_fingerprint", "SFTP_HOST_KEY_FINGERPRINT"); value != "" {
+		pinned, err := parseFingerprint(value)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid %s.host_key_fingerprint: %v", prefix, err)
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != pinned {
+				return fmt.Errorf("host key of %s has changed: the server sent %s but %s.host_key_fingerprint is %s", hostname, got, prefix, pinned)
+			}
+			return nil
+		}, "", nil
+	}
+
+	if value := destinationSetting(prefix, "insecure_ignore_host_key", ""); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid %s.insecure_ignore_host_key %q", prefix, value)
+		}
+		if insecure {
+			log.Printf("Warning: Not verifying the SFTP host key of %s, anyone in between can read the credentials", prefix)
+			return ssh.InsecureIgnoreHostKey(), "", nil
+		}
+	}
+
+	path := knownHostsPath(prefix)
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		// Read the file on every connect so `dimagram sftp trust` takes effect
+		// without a restart
+		check, err := knownhosts.New(path)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no host key is trusted for %s yet, run `dimagram sftp trust` to record it in %s", hostname, path)
+		} else if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+
+		err = check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) == 0 {
+			return fmt.Errorf("host key of %s is not in %s, run `dimagram sftp trust` to record it", hostname, path)
+		}
+		return fmt.Errorf("host key of %s has changed: the server sent %s but %s:%d has %s. "+
+			"Someone may be intercepting the connection. If the server's key really changed, run `dimagram sftp trust --replace`",
+			hostname, ssh.FingerprintSHA256(key), keyErr.Want[0].Filename, keyErr.Want[0].Line, ssh.FingerprintSHA256(keyErr.Want[0].Key))
+	}, path, nil
+}
+
+// knownHostKeyAlgorithms returns the host key algorithms of the keys recorded
+// for addr in the known_hosts file at path, or nil when there are none. The
+// server is asked for one of those, otherwise it may present a key of another
+// type that looks like a changed key.
+func knownHostKeyAlgorithms(path, addr string) ([]string, error) {
+	check, err := knownhosts.New(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	// Checking a key that is never recorded lists the ones that are
+	probe, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil, err
+	}
+	var keyErr *knownhosts.KeyError
+	if err := check(addr, &net.TCPAddr{IP: net.IPv4zero}, probe); !errors.As(err, &keyErr) {
+		return nil, err
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch keyType := known.Key.Type(); keyType {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, keyType)
+		}
+	}
+	return algorithms, nil
+}
+
+// parseFingerprint returns a SHA256 host key fingerprint in the form
+// ssh.FingerprintSHA256 prints it. It accepts the fingerprint with or without
+// the SHA256: prefix and padding, or a whole line of `ssh-keygen -l` output
+// like "256 SHA256:... host (ED25519)".
+func parseFingerprint(value string) (string, error) {
+	fields := strings.Fields(value)
+	fingerprint := ""
+	for _, field := range fields {
+		if len(field) > len("SHA256:") && strings.EqualFold(field[:len("SHA256:")], "SHA256:") {
+			fingerprint = field[len("SHA256:"):]
+			break
+		}
+	}
+	if fingerprint == "" && len(fields) == 1 {
+		fingerprint = fields[0]
+	}
+
+	sum, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(fingerprint, "="))
+	if err != nil || len(sum) != 32 {
+		return "", fmt.Errorf("%q is not a SHA256 fingerprint as `ssh-keygen -l` prints it", value)
+	}
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum), nil
+}
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Defaults of the SFTP connection pool
+const (
+	defaultSFTPIdleTimeout = 5 * time.Minute
+	defaultSFTPMaxIdle     = 4
+)
+
+// sftpConn is one SSH connection with its SFTP session
+type sftpConn struct {
+	ssh      *ssh.Client
+	sftp     *sftp.Client
+	lastUsed time.Time
+}
+
+// alive checks the connection with a cheap round trip to the server
+func (c *sftpConn) alive() bool {
+	_, err := c.sftp.Getwd()
+	return err == nil
+}
+
+func (c *sftpConn) close() {
+	c.sftp.Close()
+	c.ssh.Close()
+}
+
+// sftpPool keeps connections to one SFTP destination open between uploads
+// so bulk uploads don't pay for a handshake each time. Connections are made
+// on first use, checked before they are handed out and closed once idle for
+// longer than idleTimeout.
+type sftpPool struct {
+	addr   string
+	config *ssh.ClientConfig
+	// knownHosts is the known_hosts file the host key is checked against,
+	// empty when it is pinned or not checked
+	knownHosts  string
+	idleTimeout time.Duration
+	maxIdle     int
+	// settings identifies the configuration the pool was made with
+	settings string
+
+	mu      sync.Mutex
+	idle    []*sftpConn
+	retired bool
+}
+
+var (
+	sftpPoolsMu sync.Mutex
+	// sftpPools holds the pool of each destination by its config prefix
+	sftpPools = map[string]*sftpPool{}
+)
+
+// sftpLegacyEnv maps SFTP settings to the variables they were read from
+// before destinations were configurable
+var sftpLegacyEnv = map[string]string{
+	"host":                   "SFTP_HOST",
+	"port":                   "SFTP_PORT",
+	"user":                   "SFTP_USER",
+	"password":               "SFTP_PASSWORD",
+	"agent_socket":           "SSH_AUTH_SOCK",
+	"private_key_path":       "SFTP_PRIVATE_KEY_PATH",
+	"private_key_passphrase": "SFTP_PRIVATE_KEY_PASSPHRASE",
+	"certificate_path":       "SFTP_CERTIFICATE_PATH",
+	"host_key_fingerprint":   "SFTP_HOST_KEY_FINGERPRINT",
+	"known_hosts":            "SFTP_KNOWN_HOSTS",
+}
+
+// sftpPoolSettings returns a digest of everything the connections of the
+// destination under prefix depend on, including the key files' modification
+// times, so a changed setting can be told apart without keeping secrets
+func sftpPoolSettings(prefix string) string {
+	hash := sha256.New()
+	for _, key := range []string{
+		"host", "port", "user", "password", "auth_order", "agent_socket",
+		"private_key_path", "private_key_passphrase", "certificate_path",
+		"host_key_fingerprint", "insecure_ignore_host_key", "known_hosts",
+		"idle_timeout", "max_idle",
+	} {
+		fmt.Fprintf(hash, "%s=%q\n", key, destinationSetting(prefix, key, sftpLegacyEnv[key]))
+	}
+
+	keyPath := destinationSetting(prefix, "private_key_path", sftpLegacyEnv["private_key_path"])
+	certPath := destinationSetting(prefix, "certificate_path", sftpLegacyEnv["certificate_path"])
+	if keyPath != "" && certPath == "" {
+		certPath = keyPath + "-cert.pub"
+	}
+	for _, path := range []string{keyPath, certPath} {
+		if info, err := os.Stat(path); path != "" && err == nil {
+			fmt.Fprintf(hash, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// getSFTPPool returns the shared pool of the destination under prefix. When
+// there is none for its current settings yet, create makes one and a pool
+// made with older settings is replaced, its connections are closed.
+func getSFTPPool(prefix string, create func() (*sftpPool, error)) (*sftpPool, error) {
+	settings := sftpPoolSettings(prefix)
+
+	sftpPoolsMu.Lock()
+	defer sftpPoolsMu.Unlock()
+
+	old, ok := sftpPools[prefix]
+	if ok && old.settings == settings {
+		return old, nil
+	}
+
+	pool, err := create()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		log.Printf("SFTP settings of %s changed, reconnecting", prefix)
+		old.retire()
+	}
+	pool.settings = settings
+	sftpPools[prefix] = pool
+	go pool.reapIdle()
+	return pool, nil
+}
+
+// retire closes the idle connections of a replaced pool, connections still
+// in use are closed when they are handed back
+func (p *sftpPool) retire() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.retired = true
+	p.mu.Unlock()
+
+	for _, conn := range idle {
+		conn.close()
+	}
+}
+
+// get returns a healthy connection, reusing an idle one when possible
+func (p *sftpPool) get() (*sftpConn, error) {
+	for {
+		p.mu.Lock()
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if time.Since(conn.lastUsed) < p.idleTimeout && conn.alive() {
+			return conn, nil
+		}
+		conn.close()
+	}
+
+	return p.dial()
+}
+
+func (p *sftpPool) dial() (*sftpConn, error) {
+	// Ask for a host key of a type that is recorded, the file is read on
+	// every connect like the host key callback does
+	config := p.config
+	if p.knownHosts != "" {
+		algorithms, err := knownHostKeyAlgorithms(p.knownHosts, p.addr)
+		if err != nil {
+			return nil, err
+		}
+		withAlgorithms := *config
+		withAlgorithms.HostKeyAlgorithms = algorithms
+		config = &withAlgorithms
+	}
+
+	// Connect to SFTP server
+	sshClient, err := ssh.Dial("tcp", p.addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH server: %v", err)
+	}
+
+	// Create SFTP client
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("failed to create SFTP client: %v", err)
+	}
+
+	return &sftpConn{ssh: sshClient, sftp: sftpClient}, nil
+}
+
+// put hands conn back to the pool, broken connections are closed instead
+func (p *sftpPool) put(conn *sftpConn, broken bool) {
+	if broken {
+		conn.close()
+		return
+	}
+
+	conn.lastUsed = time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.retired || len(p.idle) >= p.maxIdle {
+		conn.close()
+		return
+	}
+	p.idle = append(p.idle, conn)
+}
+
+// reapIdle closes connections that have been idle for too long, it returns
+// once the pool is retired
+func (p *sftpPool) reapIdle() {
+	for {
+		time.Sleep(p.idleTimeout / 2)
+
+		p.mu.Lock()
+		if p.retired {
+			p.mu.Unlock()
+			return
+		}
+		var expired []*sftpConn
+		kept := p.idle[:0]
+		for _, conn := range p.idle {
+			if time.Since(conn.lastUsed) >= p.idleTimeout {
+				expired = append(expired, conn)
+			} else {
+				kept = append(kept, conn)
+			}
+		}
+		p.idle = kept
+		p.mu.Unlock()
+
+		for _, conn := range expired {
+			conn.close()
+		}
+		if len(expired) > 0 {
+			log.Printf("Closed %d idle SFTP connections to %s", len(expired), p.addr)
+		}
+	}
+}
+
+// do runs fn on a pooled connection. If fn fails because the connection
+// broke, it is retried once on a fresh one when retry is set.
+func (p *sftpPool) do(retry bool, fn func(*sftp.Client) error) error {
+	for attempt := 1; ; attempt++ {
+		conn, err := p.get()
+		if err != nil {
+			return err
+		}
+
+		err = fn(conn.sftp)
+		broken := err != nil && !conn.alive()
+		p.put(conn, broken)
+
+		if !broken || !retry || attempt > 1 {
+			return err
+		}
+		log.Printf("SFTP connection to %s broke, retrying on a new one: %v", p.addr, err)
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Store persists the album queue, the archive of published items, the
+// publish history and the index of uploaded files
+type Store interface {
+	// Queue returns the items waiting to be published, in order
+	Queue() ([]AlbumItem, error)
+	// SaveQueue replaces the queue with items
+	SaveQueue(items []AlbumItem) error
+	// Archive returns the published items, oldest first
+	Archive() ([]AlbumItem, error)
+	// SaveArchive replaces the archive with items
+	SaveArchive(items []AlbumItem) error
+	// History returns the publish records, oldest first
+	History() ([]PublishRecord, error)
+	// AddHistory appends a publish record
+	AddHistory(record PublishRecord) error
+	// Uploads returns the files uploaded to the CDN
+	Uploads() ([]UploadRecord, error)
+	// FindUpload returns the upload with the given hash, or nil if there is none
+	FindUpload(hash string) (*UploadRecord, error)
+	// AddUpload records an uploaded file, replacing any record with the same hash
+	AddUpload(record UploadRecord) error
+	// Import fills an empty store with contents, either all of it is written
+	// or the store is left empty
+	Import(contents storeContents) error
+	Close() error
+}
+
+// storeContents is everything a Store holds, as copied by migrate-store
+type storeContents struct {
+	Queue   []AlbumItem
+	Archive []AlbumItem
+	History []PublishRecord
+	Uploads []UploadRecord
+}
+
+// PublishRecord is an entry in the publish history
+type PublishRecord struct {
+	ItemID      string    `json:"item_id"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// UploadRecord describes a file uploaded through /api/upload
+type UploadRecord struct {
+	Hash       string    `json:"hash"`
+	Filename   string    `json:"filename"`
+	URL        string    `json:"url"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+func init() {
+	viper.SetDefault("store.driver", "json")
+}
+
+// openStore opens the store selected by the store.driver setting
+func openStore() (Store, error) {
+	return openStoreDriver(viper.GetString("store.driver"))
+}
+
+// openStoreDriver opens the store implementation with the given name
+func openStoreDriver(driver string) (Store, error) {
+	switch driver {
+	case "json":
+		return newJSONStore(dataDir())
+	case "sqlite":
+		return newSQLiteStore(sqlitePath())
+	default:
+		return nil, fmt.Errorf("unknown store driver %q, expected json or sqlite", driver)
+	}
+}
+
+// sqlitePath returns the database file used by the sqlite store
+func sqlitePath() string {
+	if path := viper.GetString("store.sqlite_path"); path != "" {
+		return path
+	}
+	return dataPath("dimagram.db")
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// jsonStore keeps each list as a JSON file in the data directory, this is
+// the original layout with album.json and archive.json
+type jsonStore struct {
+	dir string
+}
+
+func newJSONStore(dir string) (*jsonStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %v", err)
+	}
+	return &jsonStore{dir: dir}, nil
+}
+
+func (s *jsonStore) Queue() ([]AlbumItem, error) {
+	var items []AlbumItem
+	err := s.read("album.json", &items)
+	return items, err
+}
+
+func (s *jsonStore) SaveQueue(items []AlbumItem) error {
+	if items == nil {
+		items = []AlbumItem{}
+	}
+	return s.write("album.json", items)
+}
+
+func (s *jsonStore) Archive() ([]AlbumItem, error) {
+	var items []AlbumItem
+	err := s.read("archive.json", &items)
+	return items, err
+}
+
+func (s *jsonStore) SaveArchive(items []AlbumItem) error {
+	if items == nil {
+		items = []AlbumItem{}
+	}
+	return s.write("archive.json", items)
+}
+
+func (s *jsonStore) History() ([]PublishRecord, error) {
+	var records []PublishRecord
+	err := s.read("history.json", &records)
+	return records, err
+}
+
+func (s *jsonStore) AddHistory(record PublishRecord) error {
+	records, err := s.History()
+	if err != nil {
+		return err
+	}
+	return s.write("history.json", append(records, record))
+}
+
+func (s *jsonStore) Uploads() ([]UploadRecord, error) {
+	var records []UploadRecord
+	err := s.read("uploads.json", &records)
+	return records, err
+}
+
+func (s *jsonStore) FindUpload(hash string) (*UploadRecord, error) {
+	records, err := s.Uploads()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if record.Hash == hash {
+			return &record, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *jsonStore) AddUpload(record UploadRecord) error {
+	records, err := s.Uploads()
+	if err != nil {
+		return err
+	}
+
+	for i, existing := range records {
+		if existing.Hash == record.Hash {
+			records[i] = record
+			return s.write("uploads.json", records)
+		}
+	}
+	return s.write("uploads.json", append(records, record))
+}
+
+func (s *jsonStore) Import(contents storeContents) error {
+	if contents.Queue == nil {
+		contents.Queue = []AlbumItem{}
+	}
+	if contents.Archive == nil {
+		contents.Archive = []AlbumItem{}
+	}
+	if contents.History == nil {
+		contents.History = []PublishRecord{}
+	}
+	if contents.Uploads == nil {
+		contents.Uploads = []UploadRecord{}
+	}
+
+	// The files can't be replaced together, so the ones already written are
+	// removed again if a later one fails
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"album.json", contents.Queue},
+		{"archive.json", contents.Archive},
+		{"history.json", contents.History},
+		{"uploads.json", contents.Uploads},
+	}
+	for i, file := range files {
+		if err := s.write(file.name, file.v); err != nil {
+			for _, written := range files[:i] {
+				os.Remove(filepath.Join(s.dir, written.name))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonStore) Close() error {
+	return nil
+}
+
+// read parses a file from the data directory into v, a missing file leaves v untouched
+func (s *jsonStore) read(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading %s: %v", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %v", name, err)
+	}
+	return nil
+}
+
+// write replaces a file in the data directory with v serialized as JSON
+func (s *jsonStore) write(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error serializing %s: %v", name, err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(s.dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("error writing to %s: %v", name, err)
+	}
+	return nil
+}
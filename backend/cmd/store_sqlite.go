@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the sqlite store. Album items are kept
+// as JSON documents so new AlbumItem fields don't need a migration.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS queue (
+	position INTEGER PRIMARY KEY,
+	item     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS archive (
+	position INTEGER PRIMARY KEY,
+	item     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS history (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	item_id      TEXT NOT NULL,
+	url          TEXT NOT NULL,
+	published_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS uploads (
+	hash        TEXT PRIMARY KEY,
+	filename    TEXT NOT NULL,
+	url         TEXT NOT NULL,
+	size        INTEGER NOT NULL,
+	uploaded_at TEXT NOT NULL
+);
+`
+
+// sqliteStore keeps all state in a single embedded SQLite database
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating database directory: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite database: %v", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating sqlite schema: %v", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Queue() ([]AlbumItem, error) {
+	return s.items("queue")
+}
+
+func (s *sqliteStore) SaveQueue(items []AlbumItem) error {
+	return s.saveItems("queue", items)
+}
+
+func (s *sqliteStore) Archive() ([]AlbumItem, error) {
+	return s.items("archive")
+}
+
+func (s *sqliteStore) SaveArchive(items []AlbumItem) error {
+	return s.saveItems("archive", items)
+}
+
+func (s *sqliteStore) History() ([]PublishRecord, error) {
+	rows, err := s.db.Query("SELECT item_id, url, published_at FROM history ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %v", err)
+	}
+	defer rows.Close()
+
+	var records []PublishRecord
+	for rows.Next() {
+		var record PublishRecord
+		var publishedAt string
+		if err := rows.Scan(&record.ItemID, &record.URL, &publishedAt); err != nil {
+			return nil, fmt.Errorf("error reading history: %v", err)
+		}
+		if record.PublishedAt, err = time.Parse(time.RFC3339Nano, publishedAt); err != nil {
+			return nil, fmt.Errorf("error parsing history timestamp: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqliteStore) AddHistory(record PublishRecord) error {
+	_, err := s.db.Exec("INSERT INTO history (item_id, url, published_at) VALUES (?, ?, ?)",
+		record.ItemID, record.URL, record.PublishedAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("error writing history: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Uploads() ([]UploadRecord, error) {
+	rows, err := s.db.Query("SELECT hash, filename, url, size, uploaded_at FROM uploads ORDER BY uploaded_at")
+	if err != nil {
+		return nil, fmt.Errorf("error reading uploads: %v", err)
+	}
+	defer rows.Close()
+
+	var records []UploadRecord
+	for rows.Next() {
+		var record UploadRecord
+		var uploadedAt string
+		if err := rows.Scan(&record.Hash, &record.Filename, &record.URL, &record.Size, &uploadedAt); err != nil {
+			return nil, fmt.Errorf("error reading uploads: %v", err)
+		}
+		if record.UploadedAt, err = time.Parse(time.RFC3339Nano, uploadedAt); err != nil {
+			return nil, fmt.Errorf("error parsing upload timestamp: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqliteStore) FindUpload(hash string) (*UploadRecord, error) {
+	var record UploadRecord
+	var uploadedAt string
+	err := s.db.QueryRow("SELECT hash, filename, url, size, uploaded_at FROM uploads WHERE hash = ?", hash).
+		Scan(&record.Hash, &record.Filename, &record.URL, &record.Size, &uploadedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading upload: %v", err)
+	}
+
+	if record.UploadedAt, err = time.Parse(time.RFC3339Nano, uploadedAt); err != nil {
+		return nil, fmt.Errorf("error parsing upload timestamp: %v", err)
+	}
+	return &record, nil
+}
+
+func (s *sqliteStore) AddUpload(record UploadRecord) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO uploads (hash, filename, url, size, uploaded_at) VALUES (?, ?, ?, ?, ?)",
+		record.Hash, record.Filename, record.URL, record.Size, record.UploadedAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("error writing upload: %v", err)
+	}
+	return nil
+}
+
+// Import writes all tables in one transaction, so a failed migration leaves
+// the database empty and can simply be run again
+func (s *sqliteStore) Import(contents storeContents) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceItems(tx, "queue", contents.Queue); err != nil {
+		return err
+	}
+	if err := replaceItems(tx, "archive", contents.Archive); err != nil {
+		return err
+	}
+	for _, record := range contents.History {
+		_, err := tx.Exec("INSERT INTO history (item_id, url, published_at) VALUES (?, ?, ?)",
+			record.ItemID, record.URL, record.PublishedAt.Format(time.RFC3339Nano))
+		if err != nil {
+			return fmt.Errorf("error writing history: %v", err)
+		}
+	}
+	for _, record := range contents.Uploads {
+		_, err := tx.Exec("INSERT OR REPLACE INTO uploads (hash, filename, url, size, uploaded_at) VALUES (?, ?, ?, ?, ?)",
+			record.Hash, record.Filename, record.URL, record.Size, record.UploadedAt.Format(time.RFC3339Nano))
+		if err != nil {
+			return fmt.Errorf("error writing upload: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing import: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// items reads the ordered album items of the queue or archive table
+func (s *sqliteStore) items(table string) ([]AlbumItem, error) {
+	rows, err := s.db.Query("SELECT item FROM " + table + " ORDER BY position")
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	var items []AlbumItem
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", table, err)
+		}
+
+		var item AlbumItem
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			return nil, fmt.Errorf("error parsing %s item: %v", table, err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// saveItems replaces the contents of the queue or archive table in one transaction
+func (s *sqliteStore) saveItems(table string, items []AlbumItem) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceItems(tx, table, items); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing %s: %v", table, err)
+	}
+	return nil
+}
+
+// replaceItems replaces the contents of the queue or archive table within tx
+func replaceItems(tx *sql.Tx, table string, items []AlbumItem) error {
+	if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+		return fmt.Errorf("error clearing %s: %v", table, err)
+	}
+
+	for i, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("error serializing %s item: %v", table, err)
+		}
+		if _, err := tx.Exec("INSERT INTO "+table+" (position, item) VALUES (?, ?)", i, string(data)); err != nil {
+			return fmt.Errorf("error writing %s: %v", table, err)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,8 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
 )
@@ -12,7 +10,7 @@ import (
 var unpublishCmd = &cobra.Command{
 	Use:   "unpublish",
 	Short: "Unpublish the most recently published image",
-	Long:  `Move the most recently published image from archive back to album, and update the SFTP "today" file with the new latest image.`,
+	Long:  `Move the most recently published image from archive back to album, and update the "today" file with the new latest image.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		unpublishProcess()
 	},
@@ -24,22 +22,36 @@ func GetUnpublishCmd() *cobra.Command {
 }
 
 func unpublishProcess() {
-	// 1. Parse archive.json
-	archivePath := filepath.Join("data", "archive.json")
-	archiveFile, err := os.ReadFile(archivePath)
+	// Hold the data lock so the server can't publish or save the album meanwhile
+	unlock, err := lockData()
 	if err != nil {
-		fmt.Printf("Error reading archive.json: %v\n", err)
+		fmt.Printf("Error locking data directory: %v\n", err)
 		os.Exit(1)
 	}
+	defer unlock()
 
-	var archiveItems []AlbumItem
-	if err := json.Unmarshal(archiveFile, &archiveItems); err != nil {
-		fmt.Printf("Error parsing archive.json: %v\n", err)
+	store, err := openStore()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	// 0. Repair a publish that was interrupted half-way before undoing it
+	if err := recoverPublishJournal(store); err != nil {
+		fmt.Printf("Error recovering interrupted publish: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 1. Load the archive
+	archiveItems, err := store.Archive()
+	if err != nil {
+		fmt.Printf("Error reading archive: %v\n", err)
 		os.Exit(1)
 	}
 
 	if len(archiveItems) == 0 {
-		fmt.Println("No items in archive.json")
+		fmt.Println("No items in archive")
 		os.Exit(1)
 	}
 
@@ -48,20 +60,10 @@ func unpublishProcess() {
 	lastItem := archiveItems[lastIndex]
 	fmt.Printf("Unpublishing item: %v with URL: %s\n", lastItem.ID, lastItem.URL)
 
-	// 3. Read album.json
-	albumPath := filepath.Join("data", "album.json")
-	var albumItems []AlbumItem
-
-	albumFile, err := os.ReadFile(albumPath)
-	if err == nil {
-		// File exists, parse it
-		if err := json.Unmarshal(albumFile, &albumItems); err != nil {
-			fmt.Printf("Error parsing album.json: %v\n", err)
-			os.Exit(1)
-		}
-	} else if !os.IsNotExist(err) {
-		// Error other than file not existing
-		fmt.Printf("Error reading album.json: %v\n", err)
+	// 3. Load the album queue
+	albumItems, err := store.Queue()
+	if err != nil {
+		fmt.Printf("Error reading album: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -69,47 +71,47 @@ func unpublishProcess() {
 	archiveItems = archiveItems[:lastIndex]
 	albumItems = append([]AlbumItem{lastItem}, albumItems...)
 
-	// If there are still items in the archive, update the SFTP "today" file to the new last item
+	// If there are still items in the archive, update the "today" file to the new last item
+	var changed []string
+	permalink, permalinkErr := itemPermalinkPath(lastItem.ID)
+	if permalinkErr == nil {
+		changed = append(changed, permalink)
+	}
 	if len(archiveItems) > 0 {
 		newLastItem := archiveItems[len(archiveItems)-1]
-		if err := uploadToSFTP(newLastItem); err != nil {
-			fmt.Printf("Error uploading to SFTP server: %v\n", err)
+		if _, err := uploadToday(newLastItem); err != nil {
+			fmt.Printf("Error uploading today.json: %v\n", err)
 			os.Exit(1)
 		}
+		changed = append(changed, "today.json")
 
-		// Invalidate CDN cache
-		if err := invalidateCache(); err != nil {
-			fmt.Printf("Warning: Failed to invalidate CDN cache: %v\n", err)
-			// Continue execution even if cache invalidation fails
-		}
-
-		fmt.Printf("Updated SFTP 'today.json' file to point to the new last item: %v\n", newLastItem.ID)
+		fmt.Printf("Updated 'today.json' file to point to the new last item: %v\n", newLastItem.ID)
 	}
 
-	// 6. Write back to archive.json
-	archiveData, err := json.Marshal(archiveItems)
-	if err != nil {
-		fmt.Printf("Error serializing archive data: %v\n", err)
-		os.Exit(1)
+	// 5. Remove the permalink of the unpublished item
+	if permalinkErr != nil {
+		fmt.Printf("Warning: Not removing the permalink: %v\n", permalinkErr)
+	} else if err := deleteAll(permalink); err != nil {
+		fmt.Printf("Warning: Failed to remove the permalink: %v\n", err)
 	}
 
-	if err := os.WriteFile(archivePath, archiveData, 0o644); err != nil {
-		fmt.Printf("Error writing to archive.json: %v\n", err)
-		os.Exit(1)
+	// Invalidate CDN cache
+	if err := purgeOrQueue(changed...); err != nil {
+		fmt.Printf("Warning: Failed to invalidate CDN cache: %v\n", err)
+		// Continue execution even if cache invalidation fails
 	}
 
-	// 7. Write back to album.json
-	albumData, err := json.Marshal(albumItems)
-	if err != nil {
-		fmt.Printf("Error serializing album data: %v\n", err)
+	// 6. Write back the archive
+	if err := store.SaveArchive(archiveItems); err != nil {
+		fmt.Printf("Error writing archive: %v\n", err)
 		os.Exit(1)
 	}
 
-	if err := os.WriteFile(albumPath, albumData, 0o644); err != nil {
-		fmt.Printf("Error writing to album.json: %v\n", err)
+	// 7. Write back the album queue
+	if err := store.SaveQueue(albumItems); err != nil {
+		fmt.Printf("Error writing album: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Successfully unpublished the image, updated SFTP 'today.json' file, invalidated cache, moved item from archive to album.")
+	fmt.Println("Successfully unpublished the image, updated 'today.json' file, invalidated cache, moved item from archive to album.")
 }
-
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Length limits for the free text fields of an album item, in characters
+const (
+	maxDescriptionLength = 2000
+	maxCreditsLength     = 500
+	maxPhotoFieldLength  = 200
+)
+
+// fieldError describes a problem with one field of an album item
+type fieldError struct {
+	Index   *int   `json:"index,omitempty"`
+	ID      ItemID `json:"id,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationError collects all field errors of a request
+type validationError []fieldError
+
+func (e validationError) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+	return "invalid album data: " + strings.Join(messages, "; ")
+}
+
+// validateAlbumItem checks the fields of a single item
+func validateAlbumItem(item AlbumItem) validationError {
+	var errs validationError
+	add := func(field, message string) {
+		errs = append(errs, fieldError{ID: item.ID, Field: field, Message: message})
+	}
+
+	if !itemIDPattern.MatchString(string(item.ID)) {
+		add("id", "must be 1 to 64 letters, digits, _ or -")
+	}
+
+	if item.URL == "" {
+		add("url", "is required")
+	} else if u, err := url.Parse(item.URL); err != nil || !u.IsAbs() || u.Host == "" {
+		add("url", "must be an absolute URL")
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		add("url", "must use http or https")
+	}
+
+	if item.Srcset != "" {
+		if err := validateSrcset(item.Srcset); err != nil {
+			add("srcset", err.Error())
+		}
+	}
+
+	if n := utf8.RuneCountInString(item.Description); n > maxDescriptionLength {
+		add("description", fmt.Sprintf("is %d characters, at most %d are allowed", n, maxDescriptionLength))
+	}
+	if n := utf8.RuneCountInString(item.Credits); n > maxCreditsLength {
+		add("credits", fmt.Sprintf("is %d characters, at most %d are allowed", n, maxCreditsLength))
+	}
+
+	if item.Photo != nil {
+		fields := map[string]string{
+			"camera":        item.Photo.Camera,
+			"lens":          item.Photo.Lens,
+			"focal_length":  item.Photo.FocalLength,
+			"aperture":      item.Photo.Aperture,
+			"exposure_time": item.Photo.ExposureTime,
+			"taken_at":      item.Photo.TakenAt,
+			"artist":        item.Photo.Artist,
+			"copyright":     item.Photo.Copyright,
+		}
+		for _, field := range slices.Sorted(maps.Keys(fields)) {
+			if n := utf8.RuneCountInString(fields[field]); n > maxPhotoFieldLength {
+				add("photo."+field, fmt.Sprintf("is %d characters, at most %d are allowed", n, maxPhotoFieldLength))
+			}
+		}
+	}
+
+	if item.PublishOn != "" {
+		if _, err := time.Parse(publishDateLayout, item.PublishOn); err != nil {
+			add("publish_on", "must be a date like 2006-01-02")
+		}
+	}
+
+	return errs
+}
+
+// validateSrcset checks that every candidate of a srcset is an absolute
+// http(s) URL followed by a width like 768w
+func validateSrcset(srcset string) error {
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) != 2 {
+			return fmt.Errorf("must be a list of URLs with widths like https://example.com/a.jpg 768w")
+		}
+		if u, err := url.Parse(fields[0]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%q must be an absolute http or https URL", fields[0])
+		}
+		width, ok := strings.CutSuffix(fields[1], "w")
+		if n, err := strconv.Atoi(width); !ok || err != nil || n <= 0 {
+			return fmt.Errorf("%q must be a width like 768w", fields[1])
+		}
+	}
+	return nil
+}
+
+// validateAlbum checks every item of a queue and that their IDs are unique
+func validateAlbum(items []AlbumItem) validationError {
+	var errs validationError
+	seen := make(map[ItemID]int)
+
+	for i, item := range items {
+		index := i
+		for _, fe := range validateAlbumItem(item) {
+			fe.Index = &index
+			errs = append(errs, fe)
+		}
+
+		if first, ok := seen[item.ID]; ok {
+			errs = append(errs, fieldError{
+				Index:   &index,
+				ID:      item.ID,
+				Field:   "id",
+				Message: fmt.Sprintf("is also used by item %d", first),
+			})
+		} else {
+			seen[item.ID] = i
+		}
+	}
+
+	return append(errs, validatePublishDates(items)...)
+}
+
+// validatePublishDates checks that no two items are pinned to the same day
+func validatePublishDates(items []AlbumItem) validationError {
+	var errs validationError
+	pinned := make(map[string]int)
+
+	for i, item := range items {
+		if item.PublishOn == "" {
+			continue
+		}
+
+		index := i
+		if first, ok := pinned[item.PublishOn]; ok {
+			errs = append(errs, fieldError{
+				Index:   &index,
+				ID:      item.ID,
+				Field:   "publish_on",
+				Message: fmt.Sprintf("%s is already taken by item %s", item.PublishOn, items[first].ID),
+			})
+		} else {
+			pinned[item.PublishOn] = i
+		}
+	}
+
+	return errs
+}
+
+// decodeJSONBody parses a request body holding exactly one JSON value
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// writeRequestError answers with the field errors of a validationError, or
+// with a plain message for a body that could not be decoded at all
+func writeRequestError(w http.ResponseWriter, err error) {
+	var verr validationError
+	if errors.As(err, &verr) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "invalid album data",
+			"fields": verr,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error": fmt.Sprintf("malformed JSON: %v", err),
+	})
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/image/draw"
+)
+
+func init() {
+	viper.SetDefault("upload.variant_widths", []string{"320", "768", "1600"})
+	viper.SetDefault("upload.variant_quality", 85)
+}
+
+// imageVariant is a resized copy of an upload, stored next to the original
+// in the content directory
+type imageVariant struct {
+	Filename string `json:"-"`
+	URL      string `json:"url"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+
+	// path and size of the local file that is uploaded
+	path string
+	size int64
+}
+
+// variantWidths returns the widths of upload.variant_widths in increasing
+// order, "none" turns variants off
+func variantWidths() ([]int, error) {
+	values := configList("upload.variant_widths")
+	if len(values) == 1 && values[0] == "none" {
+		return nil, nil
+	}
+
+	var widths []int
+	for _, value := range values {
+		width, err := strconv.Atoi(value)
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("invalid width %q in upload.variant_widths", value)
+		}
+		widths = append(widths, width)
+	}
+	slices.Sort(widths)
+	return slices.Compact(widths), nil
+}
+
+// variantSizes returns the variants of an image for every configured width
+// smaller than the image, without their files. GIFs get no variants because
+// resizing would drop their animation.
+func variantSizes(info imageInfo) ([]imageVariant, error) {
+	if info.ContentType == "image/gif" {
+		return nil, nil
+	}
+	widths, err := variantWidths()
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []imageVariant
+	for _, width := range widths {
+		if width >= info.Width {
+			break
+		}
+		variants = append(variants, imageVariant{
+			Width:  width,
+			Height: max(1, int(math.Round(float64(info.Height)*float64(width)/float64(info.Width)))),
+		})
+	}
+	return variants, nil
+}
+
+func variantFilename(hash string, width int, ext string) string {
+	return fmt.Sprintf("%s-%dw%s", hash, width, ext)
+}
+
+// existingVariants returns the variants of an earlier upload of the same
+// image if all of them are still at every destination, so the image doesn't
+// have to be decoded again. Whether they are JPEGs or PNGs depends on the
+// pixels, so both names are tried.
+func existingVariants(hash string, info imageInfo) ([]imageVariant, bool) {
+	variants, err := variantSizes(info)
+	if err != nil {
+		return nil, false
+	}
+
+	for i := range variants {
+		found := false
+		for _, ext := range []string{".jpg", ".png"} {
+			variants[i].Filename = variantFilename(hash, variants[i].Width, ext)
+			if _, found = contentFileExists(variants[i].Filename, -1); found {
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return variants, true
+}
+
+// createVariants writes the variants of the image at localPath into dir,
+// named <hash>-<width>w.<ext>. Opaque images become JPEGs, images with
+// transparency PNGs. The variants carry no EXIF, so they are turned the way
+// the original's orientation says it is displayed.
+func createVariants(localPath, hash string, info imageInfo, dir string) ([]imageVariant, error) {
+	// 1. Pick the sizes to create
+	variants, err := variantSizes(info)
+	if err != nil || len(variants) == 0 {
+		return nil, err
+	}
+
+	// 2. Decode the whole image, which also catches files whose header is
+	// fine but whose pixel data is broken
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %v", err)
+	}
+	defer file.Close()
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidImage, err)
+	}
+
+	ext := ".png"
+	if opaque, ok := src.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		ext = ".jpg"
+	}
+
+	// 3. Scale, turn and encode each variant. Scaling happens in the stored
+	// orientation so only the small copy has to be turned.
+	for i := range variants {
+		variant := &variants[i]
+		width, height := variant.Width, variant.Height
+		if info.Orientation >= 5 {
+			width, height = height, width
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+		variant.Filename = variantFilename(hash, variant.Width, ext)
+		variant.path = filepath.Join(dir, variant.Filename)
+		variant.size, err = writeVariant(variant.path, orient(dst, info.Orientation), ext)
+		if err != nil {
+			removeVariants(variants[:i])
+			return nil, fmt.Errorf("failed to write %dpx variant: %v", variant.Width, err)
+		}
+	}
+
+	return variants, nil
+}
+
+// orient turns an image stored with the given EXIF orientation upright
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			// The stored pixel that is displayed at x, y
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // mirrored, turned 90° counterclockwise
+				sx, sy = y, x
+			case 6: // turned 90° counterclockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored, turned 90° clockwise
+				sx, sy = w-1-y, h-1-x
+			case 8: // turned 90° clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], img.Pix[img.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
+
+func writeVariant(path string, img image.Image, ext string) (int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if ext == ".jpg" {
+		err = jpeg.Encode(file, img, &jpeg.Options{Quality: viper.GetInt("upload.variant_quality")})
+	} else {
+		err = png.Encode(file, img)
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), file.Close()
+}
+
+// removeVariants deletes the local files of variants
+func removeVariants(variants []imageVariant) {
+	for _, variant := range variants {
+		os.Remove(variant.path)
+	}
+}
+
+// variantSrcset returns the srcset of an image served at url with the given
+// width and its variants
+func variantSrcset(url string, width int, variants []imageVariant) string {
+	candidates := make([]string, 0, len(variants)+1)
+	for _, variant := range variants {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variant.URL, variant.Width))
+	}
+	candidates = append(candidates, fmt.Sprintf("%s %dw", url, width))
+	return strings.Join(candidates, ", ")
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// putAttempts is how often a write that arrives corrupted is retried
+const putAttempts = 3
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// fileDigest is what a written file is checked against
+type fileDigest struct {
+	Size   int64
+	SHA256 string
+	MD5    string
+}
+
+func digestReader(r io.Reader) (fileDigest, error) {
+	sha := sha256.New()
+	sum := md5.New()
+	size, err := io.Copy(io.MultiWriter(sha, sum), r)
+	if err != nil {
+		return fileDigest{}, err
+	}
+
+	return fileDigest{
+		Size:   size,
+		SHA256: hex.EncodeToString(sha.Sum(nil)),
+		MD5:    hex.EncodeToString(sum.Sum(nil)),
+	}, nil
+}
+
+// verifyRemote checks that remotePath at the destination matches want. The
+// size is compared first, then the MD5 the destination reports if it has one,
+// otherwise the file is read back and hashed.
+func verifyRemote(publisher Publisher, remotePath string, want fileDigest) error {
+	info, err := publisher.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %v", remotePath, err)
+	}
+	if info.Size >= 0 && info.Size != want.Size {
+		return fmt.Errorf("%w: %s is %d bytes at the destination, expected %d", errChecksumMismatch, remotePath, info.Size, want.Size)
+	}
+
+	if info.MD5 != "" {
+		if info.MD5 != want.MD5 {
+			return fmt.Errorf("%w: %s has MD5 %s at the destination, expected %s", errChecksumMismatch, remotePath, info.MD5, want.MD5)
+		}
+		return nil
+	}
+
+	r, err := publisher.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to read back %s: %v", remotePath, err)
+	}
+	defer r.Close()
+
+	got, err := digestReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to read back %s: %v", remotePath, err)
+	}
+	if got.SHA256 != want.SHA256 {
+		return fmt.Errorf("%w: %s has SHA-256 %s at the destination, expected %s", errChecksumMismatch, remotePath, got.SHA256, want.SHA256)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
 
 	"dimagram/creator/cmd"
 	"github.com/spf13/cobra"
@@ -17,13 +18,19 @@ var rootCmd = &cobra.Command{
 
 func initConfig() {
 	viper.SetEnvPrefix("dimagram")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentFlags().String("data-dir", "data", "Directory holding album.json, archive.json and uploads")
+	viper.BindPFlag("data.dir", rootCmd.PersistentFlags().Lookup("data-dir"))
 	rootCmd.AddCommand(cmd.GetServerCmd())
 	rootCmd.AddCommand(cmd.GetUnpublishCmd())
+	rootCmd.AddCommand(cmd.GetPublishCmd())
+	rootCmd.AddCommand(cmd.GetMigrateStoreCmd())
+	rootCmd.AddCommand(cmd.GetSFTPCmd())
 }
 
 func main() {
@@ -65,7 +65,7 @@ const Sortable = (props) => {
 			}}
 			onClick={handleClick}
 		>
-			<img src={props.item.url} alt={props.item.description || `Photo ${props.item.id}`} />
+			<img src={props.item.url} srcset={props.item.srcset} sizes="400px" alt={props.item.description || `Photo ${props.item.id}`} />
 			<span class="photo-number">{props.item.id}</span>
 			{props.isSelected && <div class="selected-overlay"></div>}
 		</div>
@@ -74,16 +74,73 @@ const Sortable = (props) => {
 
 export const Album = (props) => {
 	const [albumData, setAlbumData] = createSignal([]);
+	// ETag of the album version we loaded, sent back with If-Match when saving
+	const [albumETag, setAlbumETag] = createSignal(null);
+	// The album as last loaded from or saved to the server, tells local edits
+	// apart from changes made on the server when merging
+	const [serverData, setServerData] = createSignal([]);
 
 	// Load album data from API
 	const loadAlbumData = async () => {
 		const response = await fetch('/api/album');
 		if (response.ok) {
 			const data = await response.json();
+			setAlbumETag(response.headers.get('ETag'));
+			setServerData(data);
 			setAlbumData(data);
 		}
 	};
 
+	// Remember what the server has after a successful save
+	const markSaved = (data, etag) => {
+		setServerData(data);
+		setAlbumETag(etag);
+	};
+
+	// Merge the local edits into the album's current version on the server,
+	// e.g. after the publisher removed an item. The server's order and items
+	// are kept, with the items edited, added or deleted here changed the same
+	// way. Returns the edited items that no longer exist on the server.
+	const mergeWithServer = async () => {
+		const response = await fetch('/api/album');
+		if (!response.ok) {
+			throw new Error(`Failed to load album: ${response.status}`);
+		}
+		const server = await response.json();
+
+		const base = new Map(serverData().map(item => [item.id, JSON.stringify(item)]));
+		const local = new Map(albumData().map(item => [item.id, item]));
+		const onServer = new Set(server.map(item => item.id));
+		const edited = (item) => base.get(item.id) !== JSON.stringify(item);
+
+		const merged = [];
+		for (const item of server) {
+			const mine = local.get(item.id);
+			if (mine) {
+				merged.push(edited(mine) ? mine : item);
+			} else if (!base.has(item.id)) {
+				// Added on the server, items missing locally were deleted here
+				merged.push(item);
+			}
+		}
+		const lost = [];
+		for (const item of albumData()) {
+			if (onServer.has(item.id)) {
+				continue;
+			}
+			if (!base.has(item.id)) {
+				merged.push(item);
+			} else if (edited(item)) {
+				lost.push(item);
+			}
+		}
+
+		setAlbumETag(response.headers.get('ETag'));
+		setServerData(server);
+		setAlbumData(merged);
+		return lost;
+	};
+
 	// Load album on component initialization
 	loadAlbumData();
 	const [activeItem, setActiveItem] = createSignal(null);
@@ -156,8 +213,9 @@ export const Album = (props) => {
 		addNewImageWithUrl('https://placehold.co/400x400?text=New+Image');
 	};
 	
-	// Function to add a new image with a specific URL
-	const addNewImageWithUrl = (url) => {
+	// Function to add a new image with a specific URL, details holds the
+	// srcset, suggested credits and photo metadata of an upload
+	const addNewImageWithUrl = (url, details = {}) => {
 		const currentItems = albumData();
 		const newImageId = generateUUID();
 
@@ -165,8 +223,10 @@ export const Album = (props) => {
 		const newImage = {
 			id: newImageId,
 			url: url,
+			srcset: details.srcset || undefined,
 			description: '',
-			credits: ''
+			credits: details.credits || '',
+			photo: details.photo || undefined
 		};
 
 		// Add to album data
@@ -198,6 +258,11 @@ export const Album = (props) => {
 		clearSelection,
 		getAlbumData: () => albumData(),
 		setAlbumData,
+		getETag: () => albumETag(),
+		setETag: setAlbumETag,
+		markSaved,
+		reload: loadAlbumData,
+		mergeWithServer,
 		updateItemMetadata,
 		deleteItem,
 		addNewImage,
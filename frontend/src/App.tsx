@@ -2,7 +2,7 @@ import type { Component } from 'solid-js';
 import styles from './App.module.css';
 import { createSignal } from 'solid-js';
 import { Album } from './Album';
-import ImageMetadataEditor from './ImageMetadataEditor';
+import ImageMetadataEditor, { type UploadDetails } from './ImageMetadataEditor';
 
 interface ImageData {
 	id: number;
@@ -14,6 +14,8 @@ interface ImageData {
 const App: Component = () => {
 	const [selectedImage, setSelectedImage] = createSignal<ImageData | null>(null);
 	const [albumRef, setAlbumRef] = createSignal<any>(null);
+	// Message shown above the album, e.g. when the album changed on the server
+	const [notice, setNotice] = createSignal<string | null>(null);
 
 	// Function to handle when an image is selected from the album
 	const handleImageSelect = (image: ImageData) => {
@@ -51,12 +53,12 @@ const App: Component = () => {
 	};
 	
 	// Function to add a new image with a specific URL (for uploads)
-	const handleNewImage = (imageUrl: string) => {
+	const handleNewImage = (imageUrl: string, details?: UploadDetails) => {
 		const albumRefValue = albumRef();
 		if (!albumRefValue || !albumRefValue.addNewImageWithUrl) return;
 		
 		// Use the Album's method to add a new image with the provided URL
-		albumRefValue.addNewImageWithUrl(imageUrl);
+		albumRefValue.addNewImageWithUrl(imageUrl, details);
 		
 		// The Album component will handle selection and save automatically
 	};
@@ -80,23 +82,52 @@ const App: Component = () => {
 		}
 	};
 
-	// Function to save album data to the API
-	const saveAlbumJson = async () => {
+	// Function to save album data to the API, a save refused because the
+	// album changed on the server is merged and tried once more
+	const saveAlbumJson = async (retry = true) => {
 		if (albumRef() && albumRef().getAlbumData) {
 			const albumData = albumRef().getAlbumData();
+			const headers: Record<string, string> = {
+				'Content-Type': 'application/json',
+			};
+
+			// Only overwrite the album version we loaded
+			const etag = albumRef().getETag();
+			if (etag) {
+				headers['If-Match'] = etag;
+			}
 
 			try {
 				const response = await fetch('/api/album', {
 					method: 'POST',
-					headers: {
-						'Content-Type': 'application/json',
-					},
+					headers,
 					body: JSON.stringify(albumData),
 				});
 
+				if (response.status === 412 || response.status === 428) {
+					// Someone else (or the publisher) changed the album, keep our
+					// edits on top of its current version
+					const lost: ImageData[] = await albumRef().mergeWithServer();
+					if (lost.length > 0) {
+						setNotice(`The album changed on the server. ${lost.length} edited item(s) were removed there, probably published, and are gone. Your other changes were kept.`);
+						if (lost.some(item => item.id === selectedImage()?.id)) {
+							setSelectedImage(null);
+						}
+					} else {
+						setNotice('The album changed on the server, your changes were merged into it.');
+					}
+					if (retry) {
+						await saveAlbumJson(false);
+					}
+					return;
+				}
+
 				if (!response.ok) {
 					console.error('Failed to save album:', await response.text());
+					return;
 				}
+
+				albumRef().markSaved(albumData, response.headers.get('ETag'));
 			} catch (error) {
 				console.error('Error saving album:', error);
 			}
@@ -110,10 +141,16 @@ const App: Component = () => {
 			</header>
 			<main class={styles.mainContent}>
 				<div class={styles.albumSection}>
+					{notice() && (
+						<div class={styles.notice} role="status">
+							<span>{notice()}</span>
+							<button type="button" onClick={() => setNotice(null)}>Dismiss</button>
+						</div>
+					)}
 					<Album
 						ref={setAlbumRef}
 						onSelectImage={handleImageSelect}
-						onAlbumChange={saveAlbumJson}
+						onAlbumChange={() => saveAlbumJson()}
 					/>
 				</div>
 				<div class={styles.editorSection}>
@@ -1,14 +1,34 @@
 import { Component, createSignal, Show, createEffect, onMount, onCleanup } from 'solid-js';
 import styles from './ImageMetadataEditor.module.css';
 
+interface PhotoMetadata {
+  camera?: string;
+  lens?: string;
+  focal_length?: string;
+  aperture?: string;
+  exposure_time?: string;
+  iso?: number;
+  taken_at?: string;
+  artist?: string;
+  copyright?: string;
+}
+
 interface ImageData {
   id: number;
   url: string;
   description?: string;
   credits?: string;
+  photo?: PhotoMetadata;
+}
+
+// Extra details of an upload that are stored with the new album item
+export interface UploadDetails {
+  srcset?: string;
+  credits?: string;
+  photo?: PhotoMetadata;
 }
 
-interface UploadResponse {
+interface UploadResponse extends UploadDetails {
   url: string;
 }
 
@@ -17,7 +37,7 @@ interface ImageMetadataEditorProps {
   onCancel?: () => void;
   onSave?: (imageData: ImageData) => void;
   onDelete?: (imageId: number) => void;
-  onNewImage?: (imageUrl: string) => void;
+  onNewImage?: (imageUrl: string, details?: UploadDetails) => void;
 }
 
 const ImageMetadataEditor: Component<ImageMetadataEditorProps> = (props) => {
@@ -130,7 +150,11 @@ const ImageMetadataEditor: Component<ImageMetadataEditorProps> = (props) => {
       
       // Use the onNewImage callback to add a new image with the uploaded URL
       if (props.onNewImage) {
-        props.onNewImage(data.url);
+        props.onNewImage(data.url, {
+          srcset: data.srcset,
+          credits: data.credits,
+          photo: data.photo
+        });
         setStatusMessage('Image uploaded successfully!');
       } else {
         setStatusMessage('Error: Cannot add the image to album');
@@ -195,6 +219,26 @@ const ImageMetadataEditor: Component<ImageMetadataEditorProps> = (props) => {
           <div class={styles.imagePreview}>
             <img src={props.selectedImage?.url} alt="Preview" />
           </div>
+
+          <Show when={props.selectedImage?.photo}>
+            {(photo) => (
+              <dl class={styles.photoDetails}>
+                <Show when={photo().camera}><dt>Camera</dt><dd>{photo().camera}</dd></Show>
+                <Show when={photo().lens}><dt>Lens</dt><dd>{photo().lens}</dd></Show>
+                <Show when={photo().focal_length || photo().aperture || photo().exposure_time || photo().iso}>
+                  <dt>Exposure</dt>
+                  <dd>
+                    {[photo().focal_length, photo().aperture, photo().exposure_time, photo().iso && `ISO ${photo().iso}`]
+                      .filter(Boolean)
+                      .join(' · ')}
+                  </dd>
+                </Show>
+                <Show when={photo().taken_at}><dt>Taken</dt><dd>{photo().taken_at}</dd></Show>
+                <Show when={photo().artist}><dt>Artist</dt><dd>{photo().artist}</dd></Show>
+                <Show when={photo().copyright}><dt>Copyright</dt><dd>{photo().copyright}</dd></Show>
+              </dl>
+            )}
+          </Show>
           
           <div class={styles.metadataForm}>
             <div class={styles.formGroup}>